@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"math"
+	"sort"
+	"take5/internal/engine"
+	"take5/internal/model"
+)
+
+// Advise estimates the risk of every card in v.Hand and returns them safest
+// first. Each opponent is assumed to play one card drawn uniformly from
+// v.Unseen: a card is taken as the sixth card when enough of those land
+// between its row end and itself, and a card below every row end always
+// takes the cheapest row.
+func Advise(v View) []model.CardAdvice {
+	opponents := max(v.Players-1, 0)
+	advice := make([]model.CardAdvice, 0, len(v.Hand))
+	for _, c := range v.Hand {
+		a := model.CardAdvice{Card: c.Value}
+		row, _ := engine.FindBestRow(v.Rows, c.Value)
+		a.Row = row
+		if row == -1 {
+			a.Undercut = true
+			a.TakeChance = 1
+			a.ExpectedPenalty = float64(engine.CalculateRowScore(v.Rows[CheapestRow(v.Rows)]))
+			advice = append(advice, a)
+			continue
+		}
+
+		cards := v.Rows[row].Cards
+		need := engine.MaxRowLength - len(cards)
+		end := cards[len(cards)-1].Value
+		between, betweenScore := 0, 0
+		for _, u := range v.Unseen {
+			if u.Value > end && u.Value < c.Value {
+				between++
+				betweenScore += u.Score
+			}
+		}
+		rowScore := float64(engine.CalculateRowScore(v.Rows[row]))
+		switch {
+		case need <= 0:
+			a.TakeChance = 1
+			a.ExpectedPenalty = rowScore
+		case between > 0 && len(v.Unseen) > 0:
+			p := float64(between) / float64(len(v.Unseen))
+			a.TakeChance = atLeast(opponents, p, need)
+			// The row would hold its current cards plus need of the cards in between.
+			a.ExpectedPenalty = a.TakeChance * (rowScore + float64(need)*float64(betweenScore)/float64(between))
+		}
+		advice = append(advice, a)
+	}
+	sort.SliceStable(advice, func(i, j int) bool {
+		if advice[i].ExpectedPenalty != advice[j].ExpectedPenalty {
+			return advice[i].ExpectedPenalty < advice[j].ExpectedPenalty
+		}
+		if advice[i].TakeChance != advice[j].TakeChance {
+			return advice[i].TakeChance < advice[j].TakeChance
+		}
+		return advice[i].Card < advice[j].Card
+	})
+	return advice
+}
+
+// atLeast returns P(X >= need) for X ~ Binomial(n, p).
+func atLeast(n int, p float64, need int) float64 {
+	if need > n {
+		return 0
+	}
+	total := 0.0
+	for k := need; k <= n; k++ {
+		total += binomial(n, k) * math.Pow(p, float64(k)) * math.Pow(1-p, float64(n-k))
+	}
+	return math.Min(total, 1)
+}
+
+func binomial(n, k int) float64 {
+	r := 1.0
+	for i := 1; i <= k; i++ {
+		r = r * float64(n-k+i) / float64(i)
+	}
+	return r
+}
+
+// cautious plays the card Advise ranks safest.
+type cautious struct{}
+
+func (cautious) Name() string { return "cautious" }
+
+func (cautious) PlayCard(v View) int { return Advise(v)[0].Card }
+
+func (cautious) ChooseRow(v View, _ model.Card) int { return CheapestRow(v.Rows) }
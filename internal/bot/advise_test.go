@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"math"
+	"take5/internal/engine"
+	"take5/internal/model"
+	"testing"
+)
+
+func cards(values ...int) []model.Card {
+	cs := make([]model.Card, len(values))
+	for i, v := range values {
+		cs[i] = model.Card{Value: v, Score: engine.GetScore(v)}
+	}
+	return cs
+}
+
+func TestUnseen(t *testing.T) {
+	unseen := Unseen(cards(1, 50), cards(2, 104))
+	if len(unseen) != engine.DeckSize-4 {
+		t.Fatalf("len(unseen) = %d, want %d", len(unseen), engine.DeckSize-4)
+	}
+	if unseen[0].Value != 3 || unseen[len(unseen)-1].Value != 103 {
+		t.Errorf("unseen runs %d..%d, want 3..103", unseen[0].Value, unseen[len(unseen)-1].Value)
+	}
+}
+
+func TestAdvise(t *testing.T) {
+	v := View{
+		Hand: cards(5, 31, 61, 90),
+		Rows: [engine.RowCount]model.Row{
+			{Cards: cards(10)},
+			{Cards: cards(20, 21, 22, 23, 24)},
+			{Cards: cards(60)},
+			{Cards: cards(70, 80)},
+		},
+		Players: 4,
+	}
+	v.Unseen = Unseen(v.Hand, append(append(append(cards(10), cards(20, 21, 22, 23, 24)...), cards(60)...), cards(70, 80)...))
+	advice := Advise(v)
+	byCard := map[int]model.CardAdvice{}
+	for _, a := range advice {
+		byCard[a.Card] = a
+	}
+
+	// 61 lands right behind 60: nothing can come in between.
+	if a := byCard[61]; a.Row != 2 || a.TakeChance != 0 || a.ExpectedPenalty != 0 {
+		t.Errorf("61: %+v, want row 2 without risk", a)
+	}
+	// 31 is the sixth card of the full row.
+	if a := byCard[31]; a.Row != 1 || a.TakeChance != 1 || a.ExpectedPenalty != 11 {
+		t.Errorf("31: %+v, want row 1 taken for 11", a)
+	}
+	// 5 is below every row end and takes the cheapest row.
+	if a := byCard[5]; !a.Undercut || a.Row != -1 || a.TakeChance != 1 || a.ExpectedPenalty != 3 {
+		t.Errorf("5: %+v, want an undercut costing 3", a)
+	}
+	// 90 needs three of the other players' cards in 81..89.
+	if a := byCard[90]; a.Row != 3 || a.TakeChance <= 0 || a.TakeChance >= 0.01 {
+		t.Errorf("90: %+v, want a small chance on row 3", a)
+	}
+	if advice[0].Card != 61 || advice[len(advice)-1].Card != 31 {
+		t.Errorf("ranking %v, want 61 first and 31 last", advice)
+	}
+}
+
+func TestAdviseIgnoresEmptyHands(t *testing.T) {
+	rows := [engine.RowCount]model.Row{{Cards: cards(10)}, {Cards: cards(20)}, {Cards: cards(30)}, {Cards: cards(40, 41, 42)}}
+	s := engine.State{
+		Status: engine.StatusPlaying,
+		Rows:   rows,
+		// carol is on the waiting list and was dealt nothing.
+		Hands:    map[string][]model.Card{"alice": cards(50, 60), "bob": cards(70, 80), "carol": {}},
+		Revealed: cards(10, 20, 30, 40, 41, 42),
+	}
+	v := ViewOf(s, "alice")
+	if v.Players != 2 {
+		t.Fatalf("view counts %d players, want 2", v.Players)
+	}
+	want := Advise(View{Hand: v.Hand, Rows: rows, Players: 2, Unseen: v.Unseen})
+	for i, a := range Advise(v) {
+		if a != want[i] {
+			t.Errorf("advice %+v, want %+v as between two players", a, want[i])
+		}
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	tests := []struct {
+		n, need int
+		p, want float64
+	}{
+		{3, 1, 0.5, 0.875},
+		{3, 3, 0.5, 0.125},
+		{2, 3, 0.9, 0},
+		{4, 0, 0.3, 1},
+	}
+	for _, tt := range tests {
+		if got := atLeast(tt.n, tt.p, tt.need); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("atLeast(%d, %.1f, %d) = %f, want %f", tt.n, tt.p, tt.need, got, tt.want)
+		}
+	}
+}
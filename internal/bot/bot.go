@@ -0,0 +1,180 @@
+// Package bot holds computer players for the rules engine. A Strategy only
+// sees what a seated player would see, so the same strategies can play in
+// offline simulations and at real tables.
+package bot
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"take5/internal/engine"
+	"take5/internal/model"
+)
+
+// View is one player's knowledge of a game in progress.
+type View struct {
+	PlayerID string
+	Hand     []model.Card
+	Rows     [engine.RowCount]model.Row
+	Scores   map[string]int
+	Players  int          // 本局手里还有牌的玩家数，自己也算
+	Unseen   []model.Card // 自己没见过的牌：其他人手里的和未发出的
+}
+
+// ViewOf returns what playerID can see of s.
+func ViewOf(s engine.State, playerID string) View {
+	return View{
+		PlayerID: playerID,
+		Hand:     s.Hands[playerID],
+		Rows:     s.Rows,
+		Scores:   s.Scores,
+		Players:  inPlay(s),
+		Unseen:   Unseen(s.Hands[playerID], s.Revealed),
+	}
+}
+
+// inPlay counts the players still holding cards. A room hands the engine
+// every member, including those waiting for a seat or sitting out, whose
+// hands are empty and who play no card this turn.
+func inPlay(s engine.State) int {
+	n := 0
+	for _, hand := range s.Hands {
+		if len(hand) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Unseen returns the deck minus hand and every revealed card, in order.
+func Unseen(hand, revealed []model.Card) []model.Card {
+	var seen [engine.DeckSize + 1]bool
+	for _, c := range hand {
+		seen[c.Value] = true
+	}
+	for _, c := range revealed {
+		seen[c.Value] = true
+	}
+	unseen := make([]model.Card, 0, engine.DeckSize)
+	for _, c := range engine.NewDeck() {
+		if !seen[c.Value] {
+			unseen = append(unseen, c)
+		}
+	}
+	return unseen
+}
+
+// Strategy decides a player's moves.
+type Strategy interface {
+	Name() string
+	// PlayCard returns the value of the card to play from v.Hand.
+	PlayCard(v View) int
+	// ChooseRow returns the row to take for a card lower than every row end.
+	ChooseRow(v View, card model.Card) int
+}
+
+var builtins = map[string]func(rng *rand.Rand) Strategy{
+	"lowest":   func(*rand.Rand) Strategy { return lowest{} },
+	"highest":  func(*rand.Rand) Strategy { return highest{} },
+	"random":   func(rng *rand.Rand) Strategy { return random{rng: rng} },
+	"greedy":   func(*rand.Rand) Strategy { return greedy{} },
+	"cautious": func(*rand.Rand) Strategy { return cautious{} },
+}
+
+// Names lists the built-in strategies.
+func Names() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the built-in strategy called name. rng is only used by
+// strategies that make random choices.
+func New(name string, rng *rand.Rand) (Strategy, error) {
+	f, ok := builtins[name]
+	if !ok {
+		return nil, fmt.Errorf("未知策略 %q，可选：%v", name, Names())
+	}
+	return f(rng), nil
+}
+
+// CheapestRow returns the row with the fewest bullheads, preferring the
+// shorter row on a tie.
+func CheapestRow(rows [engine.RowCount]model.Row) int {
+	best := 0
+	for i := 1; i < engine.RowCount; i++ {
+		s, b := engine.CalculateRowScore(rows[i]), engine.CalculateRowScore(rows[best])
+		if s < b || (s == b && len(rows[i].Cards) < len(rows[best].Cards)) {
+			best = i
+		}
+	}
+	return best
+}
+
+// ImmediatePenalty is the bullheads card costs if it is the only card placed
+// this turn: the row it overflows, or the cheapest row if it fits nowhere.
+func ImmediatePenalty(rows [engine.RowCount]model.Row, card int) int {
+	row, _ := engine.FindBestRow(rows, card)
+	if row == -1 {
+		return engine.CalculateRowScore(rows[CheapestRow(rows)])
+	}
+	if len(rows[row].Cards) >= engine.MaxRowLength {
+		return engine.CalculateRowScore(rows[row])
+	}
+	return 0
+}
+
+// lowest always plays its lowest card.
+type lowest struct{}
+
+func (lowest) Name() string { return "lowest" }
+
+func (lowest) PlayCard(v View) int { return v.Hand[0].Value }
+
+func (lowest) ChooseRow(v View, _ model.Card) int { return CheapestRow(v.Rows) }
+
+// highest always plays its highest card.
+type highest struct{}
+
+func (highest) Name() string { return "highest" }
+
+func (highest) PlayCard(v View) int { return v.Hand[len(v.Hand)-1].Value }
+
+func (highest) ChooseRow(v View, _ model.Card) int { return CheapestRow(v.Rows) }
+
+// random plays and chooses uniformly at random.
+type random struct {
+	rng *rand.Rand
+}
+
+func (random) Name() string { return "random" }
+
+func (s random) PlayCard(v View) int { return v.Hand[s.rng.IntN(len(v.Hand))].Value }
+
+func (s random) ChooseRow(View, model.Card) int { return s.rng.IntN(engine.RowCount) }
+
+// greedy plays the card that costs least if placed alone, preferring cards
+// that land close behind a short row.
+type greedy struct{}
+
+func (greedy) Name() string { return "greedy" }
+
+func (greedy) PlayCard(v View) int {
+	best, bestCost := v.Hand[0].Value, -1
+	for _, c := range v.Hand {
+		cost := ImmediatePenalty(v.Rows, c.Value) * 10000
+		if row, gap := engine.FindBestRow(v.Rows, c.Value); row != -1 {
+			// Longer rows are more likely to overflow before this card lands.
+			cost += len(v.Rows[row].Cards)*100 + gap
+		}
+		if bestCost == -1 || cost < bestCost {
+			best, bestCost = c.Value, cost
+		}
+	}
+	return best
+}
+
+func (greedy) ChooseRow(v View, _ model.Card) int { return CheapestRow(v.Rows) }
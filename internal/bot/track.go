@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"take5/internal/engine"
+	"take5/internal/model"
+)
+
+// Track summarises v.Unseen against the rows: how many unseen cards would
+// land on each row, which of the player's own cards would, and how many are
+// lower than every row end.
+func Track(v View) model.UnseenView {
+	t := model.UnseenView{Cards: make([]int, len(v.Unseen)), Rows: make([]model.RowGap, 0, engine.RowCount)}
+	for i, c := range v.Unseen {
+		t.Cards[i] = c.Value
+	}
+	lowest := engine.DeckSize + 1
+	for i, row := range v.Rows {
+		if len(row.Cards) == 0 {
+			continue
+		}
+		g := model.RowGap{Row: i, End: row.Cards[len(row.Cards)-1].Value, Next: engine.DeckSize + 1, Mine: []int{}}
+		for _, other := range v.Rows {
+			if len(other.Cards) > 0 {
+				if end := other.Cards[len(other.Cards)-1].Value; end > g.End && end < g.Next {
+					g.Next = end
+				}
+			}
+		}
+		lowest = min(lowest, g.End)
+		g.Room = max(engine.MaxRowLength-len(row.Cards), 0)
+		for _, c := range v.Unseen {
+			if c.Value > g.End && c.Value < g.Next {
+				g.Unseen++
+			}
+		}
+		for _, c := range v.Hand {
+			if c.Value > g.End && c.Value < g.Next {
+				g.Mine = append(g.Mine, c.Value)
+			}
+		}
+		t.Rows = append(t.Rows, g)
+	}
+	for _, c := range v.Unseen {
+		if c.Value < lowest {
+			t.Below++
+		}
+	}
+	return t
+}
@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"reflect"
+	"take5/internal/engine"
+	"take5/internal/model"
+	"testing"
+)
+
+func TestTrack(t *testing.T) {
+	v := View{
+		Hand: cards(3, 15, 50, 99),
+		Rows: [engine.RowCount]model.Row{
+			{Cards: cards(40, 45)},
+			{Cards: cards(10)},
+			{Cards: cards(90, 91, 92, 93, 94)},
+			{Cards: cards(20)},
+		},
+	}
+	v.Unseen = Unseen(v.Hand, cards(40, 45, 10, 90, 91, 92, 93, 94, 20, 1, 2))
+	got := Track(v)
+
+	if len(got.Cards) != engine.DeckSize-15 {
+		t.Errorf("%d unseen cards, want %d", len(got.Cards), engine.DeckSize-15)
+	}
+	// 4..9 are below every row end; 1..3 are seen.
+	if got.Below != 6 {
+		t.Errorf("below = %d, want 6", got.Below)
+	}
+	want := []model.RowGap{
+		{Row: 0, End: 45, Next: 94, Unseen: 43, Mine: []int{50}, Room: 3},
+		{Row: 1, End: 10, Next: 20, Unseen: 8, Mine: []int{15}, Room: 4},
+		{Row: 2, End: 94, Next: 105, Unseen: 9, Mine: []int{99}, Room: 0},
+		{Row: 3, End: 20, Next: 45, Unseen: 23, Mine: []int{}, Room: 4},
+	}
+	if !reflect.DeepEqual(got.Rows, want) {
+		t.Errorf("rows =\n%+v\nwant\n%+v", got.Rows, want)
+	}
+}
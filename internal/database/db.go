@@ -4,9 +4,11 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
+	"take5/internal/metrics"
 	"take5/internal/model"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -24,28 +26,105 @@ func NewStore(dbPath string) (*Store, error) {
 	sqlStmt := `CREATE TABLE IF NOT EXISTS game_history (id INTEGER PRIMARY KEY AUTOINCREMENT, room_id TEXT, player_name TEXT, score INTEGER, played_at DATETIME DEFAULT CURRENT_TIMESTAMP);`
 	sqlStmt += `CREATE TABLE IF NOT EXISTS rooms (id TEXT PRIMARY KEY, owner_id TEXT, status TEXT, state_json TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`
 	sqlStmt += `CREATE TABLE IF NOT EXISTS users (name TEXT PRIMARY KEY, id TEXT);`
+	sqlStmt += `CREATE TABLE IF NOT EXISTS chat_messages (id INTEGER PRIMARY KEY AUTOINCREMENT, room_id TEXT, player_id TEXT, player_name TEXT, kind TEXT, text TEXT, sent_at INTEGER);`
+	sqlStmt += `CREATE INDEX IF NOT EXISTS idx_chat_messages_room ON chat_messages (room_id, id);`
+	sqlStmt += `CREATE TABLE IF NOT EXISTS duplicate_matches (id TEXT PRIMARY KEY, state_json TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`
+	sqlStmt += `CREATE TABLE IF NOT EXISTS tournaments (id TEXT PRIMARY KEY, state_json TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);`
+	sqlStmt += `CREATE TABLE IF NOT EXISTS saved_games (room_id TEXT PRIMARY KEY, participants TEXT, names TEXT, state_json TEXT, adjourned_at DATETIME);`
+	sqlStmt += `CREATE TABLE IF NOT EXISTS archived_rooms (id TEXT, owner_id TEXT, status TEXT, state_json TEXT, last_active DATETIME, archived_at DATETIME DEFAULT CURRENT_TIMESTAMP);`
 	_, err = db.Exec(sqlStmt)
 	if err != nil {
 		return nil, err
 	}
 
+	// Columns added after the first release; older databases are migrated in place.
+	if err := addColumn(db, "game_history", "seed", "INTEGER"); err != nil {
+		return nil, err
+	}
+	if err := addColumn(db, "game_history", "bot_assisted", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return nil, err
+	}
+	if err := addColumn(db, "game_history", "series_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return nil, err
+	}
+	// Lobby chat used to be stored under an empty room ID; it now has the
+	// reserved ID "#lobby".
+	if _, err := db.Exec(`UPDATE chat_messages SET room_id = '#lobby' WHERE room_id = ''`); err != nil {
+		return nil, err
+	}
+
 	return &Store{db: db}, nil
 }
 
+// addColumn adds a column to an existing table unless it is already there.
+func addColumn(db *sql.DB, table, column, def string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    int
+			dflt       sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, def))
+	return err
+}
+
 func (s *Store) Close() {
 	if s.db != nil {
-		s.db.Close()
+		if err := s.db.Close(); err != nil {
+			logError("failed to close database", err)
+		}
 	}
 }
 
-func (s *Store) RecordGameResult(roomID string, players map[string]*model.Player) {
-	tx, _ := s.db.Begin()
-	stmt, _ := tx.Prepare("INSERT INTO game_history(room_id, player_name, score) VALUES(?, ?, ?)")
+// logError records a failed database operation in the logs and metrics.
+func logError(msg string, err error, args ...any) {
+	metrics.Errors.WithLabelValues(metrics.SourceDatabase).Inc()
+	slog.Error(msg, append(args, "err", err)...)
+}
+
+// RecordGameResult stores each player's final score together with the seed
+// the game was dealt from and the rematch series it belongs to, if any.
+func (s *Store) RecordGameResult(roomID string, seed int64, seriesID string, players map[string]*model.Player) {
+	defer metrics.ObserveSince(metrics.DBWriteDuration.WithLabelValues("record_game_result"), time.Now())
+	tx, err := s.db.Begin()
+	if err != nil {
+		logError("failed to begin game result transaction", err, "room_id", roomID)
+		return
+	}
+	stmt, err := tx.Prepare("INSERT INTO game_history(room_id, player_name, score, seed, bot_assisted, series_id) VALUES(?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		logError("failed to prepare game result insert", err, "room_id", roomID)
+		tx.Rollback()
+		return
+	}
 	defer stmt.Close()
 	for _, p := range players {
-		stmt.Exec(roomID, p.Name, p.Score)
+		if _, err := stmt.Exec(roomID, p.Name, p.Score, seed, p.BotAssisted, seriesID); err != nil {
+			logError("failed to record game result", err, "room_id", roomID, "player_id", p.ID)
+			tx.Rollback()
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logError("failed to commit game result", err, "room_id", roomID)
 	}
-	tx.Commit()
 }
 
 func (s *Store) GetOrCreateUserID(name string) string {
@@ -56,9 +135,14 @@ func (s *Store) GetOrCreateUserID(name string) string {
 	}
 
 	id = fmt.Sprintf("user_%d_%d", rand.Int(), rand.Int())
+	start := time.Now()
 	_, err = s.db.Exec("INSERT INTO users (name, id) VALUES (?, ?)", name, id)
+	metrics.ObserveSince(metrics.DBWriteDuration.WithLabelValues("create_user"), start)
 	if err != nil {
-		s.db.QueryRow("SELECT id FROM users WHERE name = ?", name).Scan(&id)
+		// Most likely a concurrent insert for the same name; use the winner's ID.
+		if err := s.db.QueryRow("SELECT id FROM users WHERE name = ?", name).Scan(&id); err != nil {
+			logError("failed to create user", err, "name", name)
+		}
 	}
 	return id
 }
@@ -66,15 +150,20 @@ func (s *Store) GetOrCreateUserID(name string) string {
 func (s *Store) GetRoomStats(roomID string) []model.PlayerStat {
 	stats := make([]model.PlayerStat, 0)
 
-	rows, err := s.db.Query(`SELECT player_name, COUNT(*) as games, SUM(score) as total_score FROM game_history WHERE room_id = ? GROUP BY player_name ORDER BY total_score ASC`, roomID)
+	// Games partly played by a bot substitute are kept in the history but left out of the stats.
+	rows, err := s.db.Query(`SELECT player_name, COUNT(*) as games, SUM(score) as total_score FROM game_history WHERE room_id = ? AND bot_assisted = 0 GROUP BY player_name ORDER BY total_score ASC`, roomID)
 	if err != nil {
+		logError("failed to query room stats", err, "room_id", roomID)
 		return stats
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var st model.PlayerStat
-		rows.Scan(&st.Name, &st.TotalGames, &st.TotalScore)
+		if err := rows.Scan(&st.Name, &st.TotalGames, &st.TotalScore); err != nil {
+			logError("failed to scan room stats", err, "room_id", roomID)
+			continue
+		}
 		stats = append(stats, st)
 	}
 	return stats
@@ -91,12 +180,15 @@ func (s *Store) LoadRooms() (map[string]*model.Room, error) {
 	for rows.Next() {
 		var id, ownerId, status string
 		var stateJSON sql.NullString // Use NullString to handle potential NULLs
-		rows.Scan(&id, &ownerId, &status, &stateJSON)
+		if err := rows.Scan(&id, &ownerId, &status, &stateJSON); err != nil {
+			logError("failed to scan room", err)
+			continue
+		}
 
 		newRoom := &model.Room{}
 		if stateJSON.Valid && stateJSON.String != "" {
 			if err := json.Unmarshal([]byte(stateJSON.String), newRoom); err != nil {
-				log.Printf("Failed to unmarshal room %s: %v", id, err)
+				logError("failed to unmarshal room", err, "room_id", id)
 				continue
 			}
 			// Ensure essential fields are set even if JSON override them wrongly (though JSON usually has truth)
@@ -113,23 +205,250 @@ func (s *Store) LoadRooms() (map[string]*model.Room, error) {
 		}
 		rooms[id] = newRoom
 	}
-	return rooms, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rooms, s.restoreSavedGames(rooms)
+}
+
+// restoreSavedGames brings back adjourned games whose live room row is gone,
+// from the snapshot taken when they were adjourned.
+func (s *Store) restoreSavedGames(rooms map[string]*model.Room) error {
+	rows, err := s.db.Query("SELECT room_id, state_json FROM saved_games")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, stateJSON string
+		if err := rows.Scan(&id, &stateJSON); err != nil {
+			logError("failed to scan saved game", err)
+			continue
+		}
+		if _, ok := rooms[id]; ok {
+			continue
+		}
+		r := &model.Room{}
+		if err := json.Unmarshal([]byte(stateJSON), r); err != nil {
+			logError("failed to unmarshal saved game", err, "room_id", id)
+			continue
+		}
+		r.ID = id
+		rooms[id] = r
+		slog.Info("restored adjourned game from its snapshot", "room_id", id)
+	}
+	return rows.Err()
+}
+
+// SaveGame stores the snapshot of an adjourned room and who it waits for.
+func (s *Store) SaveGame(g model.SavedGame, r *model.Room) {
+	defer metrics.ObserveSince(metrics.DBWriteDuration.WithLabelValues("save_game"), time.Now())
+	state, err := json.Marshal(r)
+	if err != nil {
+		logError("failed to marshal saved game", err, "room_id", r.ID)
+		return
+	}
+	participants, _ := json.Marshal(g.Participants)
+	names, _ := json.Marshal(g.Names)
+	_, err = s.db.Exec("INSERT OR REPLACE INTO saved_games (room_id, participants, names, state_json, adjourned_at) VALUES (?, ?, ?, ?, ?)",
+		g.RoomID, string(participants), string(names), string(state), g.AdjournedAt)
+	if err != nil {
+		logError("failed to save game", err, "room_id", r.ID)
+	}
+}
+
+// DeleteSavedGame forgets the snapshot of a game that resumed or was dropped.
+func (s *Store) DeleteSavedGame(roomID string) {
+	if _, err := s.db.Exec("DELETE FROM saved_games WHERE room_id = ?", roomID); err != nil {
+		logError("failed to delete saved game", err, "room_id", roomID)
+	}
+}
+
+// SavedGames lists every adjourned game, oldest first.
+func (s *Store) SavedGames() []model.SavedGame {
+	games := make([]model.SavedGame, 0)
+	rows, err := s.db.Query("SELECT room_id, participants, names, adjourned_at FROM saved_games ORDER BY adjourned_at")
+	if err != nil {
+		logError("failed to query saved games", err)
+		return games
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g model.SavedGame
+		var participants, names string
+		if err := rows.Scan(&g.RoomID, &participants, &names, &g.AdjournedAt); err != nil {
+			logError("failed to scan saved game", err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(participants), &g.Participants); err != nil {
+			logError("failed to decode saved game participants", err, "room_id", g.RoomID)
+			continue
+		}
+		if err := json.Unmarshal([]byte(names), &g.Names); err != nil {
+			logError("failed to decode saved game names", err, "room_id", g.RoomID)
+			continue
+		}
+		games = append(games, g)
+	}
+	return games
 }
 
 func (s *Store) PersistRoom(r *model.Room) {
 	data, err := json.Marshal(r)
 	if err != nil {
-		log.Println("Error marshaling room:", err)
+		logError("failed to marshal room", err, "room_id", r.ID)
 		return
 	}
 	// Use UPDATE if exists, or INSERT OR REPLACE logic.
 	// Since we always have ID, REPLACE INTO is fine.
+	start := time.Now()
 	_, err = s.db.Exec("INSERT OR REPLACE INTO rooms (id, owner_id, status, state_json) VALUES (?, ?, ?, ?)", r.ID, r.OwnerID, r.Status, string(data))
+	metrics.ObserveSince(metrics.DBWriteDuration.WithLabelValues("persist_room"), start)
 	if err != nil {
-		log.Println("Error persisting room:", err)
+		logError("failed to persist room", err, "room_id", r.ID)
 	}
 }
 
 func (s *Store) DeleteRoom(roomID string) {
-	s.db.Exec("DELETE FROM rooms WHERE id = ?", roomID)
+	defer metrics.ObserveSince(metrics.DBWriteDuration.WithLabelValues("delete_room"), time.Now())
+	if _, err := s.db.Exec("DELETE FROM rooms WHERE id = ?", roomID); err != nil {
+		logError("failed to delete room", err, "room_id", roomID)
+	}
+	if _, err := s.db.Exec("DELETE FROM chat_messages WHERE room_id = ?", roomID); err != nil {
+		logError("failed to delete room chat", err, "room_id", roomID)
+	}
+	s.DeleteSavedGame(roomID)
+}
+
+func (s *Store) SaveChatMessage(roomID string, msg model.ChatMessage) {
+	defer metrics.ObserveSince(metrics.DBWriteDuration.WithLabelValues("save_chat"), time.Now())
+	_, err := s.db.Exec("INSERT INTO chat_messages (room_id, player_id, player_name, kind, text, sent_at) VALUES (?, ?, ?, ?, ?, ?)",
+		roomID, msg.PlayerID, msg.Name, msg.Kind, msg.Text, msg.SentAt)
+	if err != nil {
+		logError("failed to save chat message", err, "room_id", roomID, "player_id", msg.PlayerID)
+	}
+}
+
+// GetChatHistory returns up to limit of the room's most recent chat messages,
+// oldest first.
+func (s *Store) GetChatHistory(roomID string, limit int) []model.ChatMessage {
+	history := make([]model.ChatMessage, 0)
+	rows, err := s.db.Query(`SELECT player_id, player_name, kind, text, sent_at FROM (SELECT * FROM chat_messages WHERE room_id = ? ORDER BY id DESC LIMIT ?) ORDER BY id ASC`, roomID, limit)
+	if err != nil {
+		logError("failed to query chat history", err, "room_id", roomID)
+		return history
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg model.ChatMessage
+		if err := rows.Scan(&msg.PlayerID, &msg.Name, &msg.Kind, &msg.Text, &msg.SentAt); err != nil {
+			logError("failed to scan chat message", err, "room_id", roomID)
+			continue
+		}
+		history = append(history, msg)
+	}
+	return history
+}
+
+// ArchiveRoom moves a room from the live rooms table into archived_rooms.
+// The room's game_history rows are left untouched so its stats survive; its
+// chat is dropped so a new room reusing the ID starts clean.
+func (s *Store) ArchiveRoom(r *model.Room) error {
+	defer metrics.ObserveSince(metrics.DBWriteDuration.WithLabelValues("archive_room"), time.Now())
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO archived_rooms (id, owner_id, status, state_json, last_active) VALUES (?, ?, ?, ?, ?)", r.ID, r.OwnerID, r.Status, string(data), r.LastActive); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM rooms WHERE id = ?", r.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM chat_messages WHERE room_id = ?", r.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// PersistDuplicate saves a duplicate match, including its results so far.
+func (s *Store) PersistDuplicate(d *model.DuplicateMatch) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		logError("failed to marshal duplicate match", err, "duplicate_id", d.ID)
+		return
+	}
+	defer metrics.ObserveSince(metrics.DBWriteDuration.WithLabelValues("persist_duplicate"), time.Now())
+	if _, err := s.db.Exec("INSERT OR REPLACE INTO duplicate_matches (id, state_json) VALUES (?, ?)", d.ID, string(data)); err != nil {
+		logError("failed to persist duplicate match", err, "duplicate_id", d.ID)
+	}
+}
+
+func (s *Store) LoadDuplicates() (map[string]*model.DuplicateMatch, error) {
+	matches := make(map[string]*model.DuplicateMatch)
+	rows, err := s.db.Query("SELECT id, state_json FROM duplicate_matches")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, stateJSON string
+		if err := rows.Scan(&id, &stateJSON); err != nil {
+			logError("failed to scan duplicate match", err)
+			continue
+		}
+		d := &model.DuplicateMatch{}
+		if err := json.Unmarshal([]byte(stateJSON), d); err != nil {
+			logError("failed to unmarshal duplicate match", err, "duplicate_id", id)
+			continue
+		}
+		d.ID = id
+		matches[id] = d
+	}
+	return matches, rows.Err()
+}
+
+// PersistTournament saves a tournament with its entrants, tables and history.
+func (s *Store) PersistTournament(t *model.TournamentState) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		logError("failed to marshal tournament", err, "tournament_id", t.ID)
+		return
+	}
+	defer metrics.ObserveSince(metrics.DBWriteDuration.WithLabelValues("persist_tournament"), time.Now())
+	if _, err := s.db.Exec("INSERT OR REPLACE INTO tournaments (id, state_json) VALUES (?, ?)", t.ID, string(data)); err != nil {
+		logError("failed to persist tournament", err, "tournament_id", t.ID)
+	}
+}
+
+func (s *Store) LoadTournaments() (map[string]*model.Tournament, error) {
+	tournaments := make(map[string]*model.Tournament)
+	rows, err := s.db.Query("SELECT id, state_json FROM tournaments")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, stateJSON string
+		if err := rows.Scan(&id, &stateJSON); err != nil {
+			logError("failed to scan tournament", err)
+			continue
+		}
+		t := &model.Tournament{}
+		if err := json.Unmarshal([]byte(stateJSON), &t.TournamentState); err != nil {
+			logError("failed to unmarshal tournament", err, "tournament_id", id)
+			continue
+		}
+		t.ID = id
+		tournaments[id] = t
+	}
+	return tournaments, rows.Err()
 }
@@ -0,0 +1,325 @@
+// Package engine is the rules of 6 nimmt! as a pure state machine. It knows
+// nothing about connections, persistence or timing: Apply takes a state and
+// an action and returns the next state plus the events that happened, so a
+// game can be driven by the server, a simulator or a test alike.
+package engine
+
+import (
+	"errors"
+	"sort"
+	"take5/internal/model"
+)
+
+// Game statuses, shared with model.Room.Status.
+const (
+	StatusWaiting     = "waiting"
+	StatusPlaying     = "playing"
+	StatusChoosingRow = "choosing_row"
+	StatusFinished    = "finished"
+)
+
+var (
+	ErrPlayerCount     = errors.New("engine: need between 1 and MaxPlayers players")
+	ErrDeckTooSmall    = errors.New("engine: deck too small for the players")
+	ErrNotPlaying      = errors.New("engine: no card can be played now")
+	ErrAlreadySelected = errors.New("engine: card already selected this turn")
+	ErrCardNotInHand   = errors.New("engine: card not in hand")
+	ErrNotYourChoice   = errors.New("engine: no row choice pending for this player")
+	ErrInvalidRow      = errors.New("engine: invalid row")
+	ErrNotInGame       = errors.New("engine: player not dealt in")
+	ErrUnknownAction   = errors.New("engine: unknown action")
+)
+
+// State is everything the rules need to know about a game in progress.
+type State struct {
+	Status      string
+	Rows        [RowCount]model.Row
+	Hands       map[string][]model.Card
+	Scores      map[string]int
+	Piles       map[string][]model.Card // 每位玩家本局收走的牌
+	Selected    map[string]model.Card   // 本回合已选但未亮出的牌
+	TurnQueue   []model.PlayAction      // 已亮出、按牌面从小到大等待放置的牌
+	PendingPlay *model.PlayAction       // 等待选行的那张牌
+	Revealed    []model.Card            // 本局已公开过的牌：行首和每回合亮出的牌
+}
+
+// Clone returns a deep copy of s, so Apply never mutates its input.
+func (s State) Clone() State {
+	c := s
+	for i := range s.Rows {
+		c.Rows[i].Cards = append([]model.Card(nil), s.Rows[i].Cards...)
+	}
+	c.Hands = make(map[string][]model.Card, len(s.Hands))
+	for id, h := range s.Hands {
+		c.Hands[id] = append([]model.Card(nil), h...)
+	}
+	c.Scores = make(map[string]int, len(s.Scores))
+	for id, v := range s.Scores {
+		c.Scores[id] = v
+	}
+	c.Piles = make(map[string][]model.Card, len(s.Piles))
+	for id, p := range s.Piles {
+		c.Piles[id] = append([]model.Card(nil), p...)
+	}
+	c.Selected = make(map[string]model.Card, len(s.Selected))
+	for id, v := range s.Selected {
+		c.Selected[id] = v
+	}
+	c.TurnQueue = append([]model.PlayAction(nil), s.TurnQueue...)
+	c.Revealed = append([]model.Card(nil), s.Revealed...)
+	if s.PendingPlay != nil {
+		p := *s.PendingPlay
+		c.PendingPlay = &p
+	}
+	return c
+}
+
+// Action is one input to the state machine.
+type Action interface {
+	isAction()
+}
+
+// Deal starts a game: HandSize cards to each player in order, then one card
+// to start each row. Deck must already be shuffled.
+type Deal struct {
+	Deck    []model.Card
+	Players []string
+}
+
+// PlayCard commits a card from the player's hand for the current turn.
+type PlayCard struct {
+	PlayerID string
+	Value    int
+}
+
+// ChooseRow takes a row for the pending card that fitted nowhere.
+type ChooseRow struct {
+	PlayerID string
+	Row      int
+}
+
+// Forfeit withdraws a player from the rest of the game: their hand and any
+// card they selected or are choosing a row for are discarded. Their score
+// so far stands.
+type Forfeit struct {
+	PlayerID string
+}
+
+func (Deal) isAction()      {}
+func (PlayCard) isAction()  {}
+func (ChooseRow) isAction() {}
+func (Forfeit) isAction()   {}
+
+// Apply runs a on a copy of s. On error the returned state is s unchanged
+// and no events are returned.
+func Apply(s State, a Action) (State, []Event, error) {
+	next := s.Clone()
+	var events []Event
+	var err error
+	switch a := a.(type) {
+	case Deal:
+		events, err = next.deal(a)
+	case PlayCard:
+		events, err = next.playCard(a)
+	case ChooseRow:
+		events, err = next.chooseRow(a)
+	case Forfeit:
+		events, err = next.forfeit(a)
+	default:
+		err = ErrUnknownAction
+	}
+	if err != nil {
+		return s, nil, err
+	}
+	return next, events, nil
+}
+
+func (s *State) deal(a Deal) ([]Event, error) {
+	if len(a.Players) == 0 || len(a.Players) > MaxPlayers {
+		return nil, ErrPlayerCount
+	}
+	if len(a.Deck) < len(a.Players)*HandSize+RowCount {
+		return nil, ErrDeckTooSmall
+	}
+	idx := 0
+	s.Hands = make(map[string][]model.Card, len(a.Players))
+	s.Scores = make(map[string]int, len(a.Players))
+	s.Piles = make(map[string][]model.Card, len(a.Players))
+	for _, id := range a.Players {
+		// Copy so sorting the hand leaves the deck order intact.
+		hand := append([]model.Card(nil), a.Deck[idx:idx+HandSize]...)
+		sort.Slice(hand, func(i, j int) bool { return hand[i].Value < hand[j].Value })
+		s.Hands[id] = hand
+		s.Scores[id] = 0
+		idx += HandSize
+	}
+	s.Revealed = make([]model.Card, 0, DeckSize)
+	for i := 0; i < RowCount; i++ {
+		s.Rows[i].Cards = []model.Card{a.Deck[idx]}
+		s.Revealed = append(s.Revealed, a.Deck[idx])
+		idx++
+	}
+	s.Selected = make(map[string]model.Card)
+	s.TurnQueue = nil
+	s.PendingPlay = nil
+	s.Status = StatusPlaying
+	return []Event{GameStarted{Players: append([]string(nil), a.Players...)}}, nil
+}
+
+func (s *State) playCard(a PlayCard) ([]Event, error) {
+	if s.Status != StatusPlaying {
+		return nil, ErrNotPlaying
+	}
+	if _, ok := s.Selected[a.PlayerID]; ok {
+		return nil, ErrAlreadySelected
+	}
+	i := handIndex(s.Hands[a.PlayerID], a.Value)
+	if i < 0 {
+		return nil, ErrCardNotInHand
+	}
+	s.Selected[a.PlayerID] = s.Hands[a.PlayerID][i]
+	return s.reveal([]Event{CardSelected{PlayerID: a.PlayerID}}), nil
+}
+
+// reveal turns the selected cards over and resolves the turn once every
+// player with cards left has selected one.
+func (s *State) reveal(events []Event) []Event {
+	for id, hand := range s.Hands {
+		if _, ok := s.Selected[id]; !ok && len(hand) > 0 {
+			return events
+		}
+	}
+
+	s.TurnQueue = make([]model.PlayAction, 0, len(s.Selected))
+	for id, card := range s.Selected {
+		card.OwnerID = id
+		s.TurnQueue = append(s.TurnQueue, model.PlayAction{PlayerID: id, Card: card})
+	}
+	s.Selected = make(map[string]model.Card)
+	sort.Slice(s.TurnQueue, func(i, j int) bool { return s.TurnQueue[i].Card.Value < s.TurnQueue[j].Card.Value })
+	for _, play := range s.TurnQueue {
+		s.Revealed = append(s.Revealed, play.Card)
+	}
+	events = append(events, TurnRevealed{Plays: append([]model.PlayAction(nil), s.TurnQueue...)})
+	return s.resolve(events)
+}
+
+func (s *State) chooseRow(a ChooseRow) ([]Event, error) {
+	if s.Status != StatusChoosingRow || s.PendingPlay == nil || s.PendingPlay.PlayerID != a.PlayerID {
+		return nil, ErrNotYourChoice
+	}
+	if a.Row < 0 || a.Row >= RowCount {
+		return nil, ErrInvalidRow
+	}
+	play := *s.PendingPlay
+	taken, penalty := s.takeRow(a.PlayerID, a.Row, play.Card)
+	s.TurnQueue = s.TurnQueue[1:]
+	s.PendingPlay = nil
+	events := []Event{RowTaken{PlayerID: a.PlayerID, Card: play.Card, Row: a.Row, Cards: taken, Penalty: penalty}}
+	return s.resolve(events), nil
+}
+
+func (s *State) forfeit(a Forfeit) ([]Event, error) {
+	if s.Status != StatusPlaying && s.Status != StatusChoosingRow {
+		return nil, ErrNotPlaying
+	}
+	if _, ok := s.Hands[a.PlayerID]; !ok {
+		return nil, ErrNotInGame
+	}
+	// A card already revealed this turn is still placed; the rest are dropped.
+	var kept, discarded []model.Card
+	for _, c := range s.Hands[a.PlayerID] {
+		if queued(s.TurnQueue, a.PlayerID, c.Value) {
+			kept = append(kept, c)
+		} else {
+			discarded = append(discarded, c)
+		}
+	}
+	s.Hands[a.PlayerID] = kept
+	delete(s.Selected, a.PlayerID)
+	events := []Event{PlayerForfeited{PlayerID: a.PlayerID, Discarded: discarded}}
+	if s.Status == StatusChoosingRow {
+		if s.PendingPlay.PlayerID != a.PlayerID {
+			return events, nil
+		}
+		// The card waiting for a row is dropped and the turn goes on without it.
+		s.TurnQueue = s.TurnQueue[1:]
+		s.PendingPlay = nil
+		return s.resolve(events), nil
+	}
+	return s.reveal(events), nil
+}
+
+// resolve places queued cards in order until the queue is empty or a card
+// needs its owner to choose a row.
+func (s *State) resolve(events []Event) []Event {
+	for len(s.TurnQueue) > 0 {
+		play := s.TurnQueue[0]
+		card := play.Card
+		if i := handIndex(s.Hands[play.PlayerID], card.Value); i >= 0 {
+			s.Hands[play.PlayerID] = append(s.Hands[play.PlayerID][:i], s.Hands[play.PlayerID][i+1:]...)
+		}
+
+		row, _ := FindBestRow(s.Rows, card.Value)
+		if row == -1 {
+			// Card is smaller than all row ends, player must choose a row
+			s.Status = StatusChoosingRow
+			s.PendingPlay = &play
+			return append(events, RowChoiceNeeded{PlayerID: play.PlayerID, Card: card})
+		}
+		if len(s.Rows[row].Cards) >= MaxRowLength {
+			taken, penalty := s.takeRow(play.PlayerID, row, card)
+			events = append(events, RowTaken{PlayerID: play.PlayerID, Card: card, Row: row, Cards: taken, Penalty: penalty, Overflow: true})
+		} else {
+			s.Rows[row].Cards = append(s.Rows[row].Cards, card)
+			events = append(events, CardPlaced{PlayerID: play.PlayerID, Card: card, Row: row})
+		}
+		s.TurnQueue = s.TurnQueue[1:]
+	}
+
+	s.PendingPlay = nil
+	for _, hand := range s.Hands {
+		if len(hand) > 0 {
+			s.Status = StatusPlaying
+			return append(events, TurnResolved{})
+		}
+	}
+	s.Status = StatusFinished
+	scores := make(map[string]int, len(s.Scores))
+	for id, v := range s.Scores {
+		scores[id] = v
+	}
+	return append(events, GameFinished{Scores: scores})
+}
+
+// takeRow moves row into playerID's pile, charges its bullheads and starts
+// the row again with card. It returns the cards taken and their penalty.
+func (s *State) takeRow(playerID string, row int, card model.Card) ([]model.Card, int) {
+	taken := s.Rows[row].Cards
+	penalty := CalculateRowScore(s.Rows[row])
+	s.Scores[playerID] += penalty
+	if s.Piles == nil {
+		s.Piles = make(map[string][]model.Card)
+	}
+	s.Piles[playerID] = append(s.Piles[playerID], taken...)
+	s.Rows[row].Cards = []model.Card{card}
+	return taken, penalty
+}
+
+func queued(queue []model.PlayAction, playerID string, value int) bool {
+	for _, p := range queue {
+		if p.PlayerID == playerID && p.Card.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func handIndex(hand []model.Card, value int) int {
+	for i, c := range hand {
+		if c.Value == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,388 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"take5/internal/model"
+	"testing"
+)
+
+func cards(values ...int) []model.Card {
+	return row(values...).Cards
+}
+
+// playing returns a state in the middle of a game with the given rows and hands.
+func playing(rows [RowCount]model.Row, hands map[string][]model.Card) State {
+	s := State{
+		Status:   StatusPlaying,
+		Rows:     rows,
+		Hands:    hands,
+		Scores:   map[string]int{},
+		Piles:    map[string][]model.Card{},
+		Selected: map[string]model.Card{},
+	}
+	for id := range hands {
+		s.Scores[id] = 0
+	}
+	return s
+}
+
+// mustApply applies each action in turn and returns the final state and the
+// events of the last action.
+func mustApply(t *testing.T, s State, actions ...Action) (State, []Event) {
+	t.Helper()
+	var events []Event
+	var err error
+	for _, a := range actions {
+		s, events, err = Apply(s, a)
+		if err != nil {
+			t.Fatalf("Apply(%#v): %v", a, err)
+		}
+	}
+	return s, events
+}
+
+func rowValues(r model.Row) []int {
+	values := []int{}
+	for _, c := range r.Cards {
+		values = append(values, c.Value)
+	}
+	return values
+}
+
+func TestDeal(t *testing.T) {
+	s, events := mustApply(t, State{}, Deal{Deck: NewDeck(), Players: []string{"b", "a"}})
+	if s.Status != StatusPlaying {
+		t.Errorf("status = %q, want %q", s.Status, StatusPlaying)
+	}
+	// Hands follow the order of Players, not the IDs.
+	if got := s.Hands["b"]; !reflect.DeepEqual(got, cards(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)) {
+		t.Errorf("hand b = %v", got)
+	}
+	if got := s.Hands["a"]; got[0].Value != 11 || got[9].Value != 20 {
+		t.Errorf("hand a = %v", got)
+	}
+	for i, want := range []int{21, 22, 23, 24} {
+		if got := rowValues(s.Rows[i]); !reflect.DeepEqual(got, []int{want}) {
+			t.Errorf("row %d = %v, want [%d]", i, got, want)
+		}
+	}
+	if len(events) != 1 {
+		t.Fatalf("events = %#v", events)
+	}
+	if ev, ok := events[0].(GameStarted); !ok || !reflect.DeepEqual(ev.Players, []string{"b", "a"}) {
+		t.Errorf("event = %#v, want GameStarted", events[0])
+	}
+}
+
+func TestDealSortsHands(t *testing.T) {
+	deck := append(cards(9, 3, 7, 1, 5, 2, 8, 4, 10, 6), cards(50, 40, 30, 20)...)
+	s, _ := mustApply(t, State{}, Deal{Deck: deck, Players: []string{"a"}})
+	if got := s.Hands["a"]; !reflect.DeepEqual(got, cards(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)) {
+		t.Errorf("hand = %v, want sorted", got)
+	}
+	if deck[0].Value != 9 {
+		t.Errorf("Deal reordered the caller's deck")
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	rows := [RowCount]model.Row{row(10), row(20), row(30), row(40)}
+	base := playing(rows, map[string][]model.Card{"a": cards(5, 50), "b": cards(60, 70)})
+	selected := base.Clone()
+	selected.Selected["a"] = model.Card{Value: 50, Score: 3}
+	choosing := base.Clone()
+	choosing.Status = StatusChoosingRow
+	choosing.PendingPlay = &model.PlayAction{PlayerID: "a", Card: model.Card{Value: 5, Score: 2}}
+	choosing.TurnQueue = []model.PlayAction{*choosing.PendingPlay}
+
+	tests := []struct {
+		name   string
+		state  State
+		action Action
+		want   error
+	}{
+		{"deal without players", State{}, Deal{Deck: NewDeck()}, ErrPlayerCount},
+		{"deal too many players", State{}, Deal{Deck: NewDeck(), Players: make([]string, MaxPlayers+1)}, ErrPlayerCount},
+		{"deal short deck", State{}, Deal{Deck: NewDeck()[:23], Players: []string{"a", "b"}}, ErrDeckTooSmall},
+		{"play before deal", State{Status: StatusWaiting}, PlayCard{PlayerID: "a", Value: 5}, ErrNotPlaying},
+		{"play while choosing", choosing, PlayCard{PlayerID: "b", Value: 60}, ErrNotPlaying},
+		{"card not in hand", base, PlayCard{PlayerID: "a", Value: 60}, ErrCardNotInHand},
+		{"unknown player", base, PlayCard{PlayerID: "c", Value: 5}, ErrCardNotInHand},
+		{"second card", selected, PlayCard{PlayerID: "a", Value: 5}, ErrAlreadySelected},
+		{"choose without pending", base, ChooseRow{PlayerID: "a", Row: 0}, ErrNotYourChoice},
+		{"choose for someone else", choosing, ChooseRow{PlayerID: "b", Row: 0}, ErrNotYourChoice},
+		{"choose negative row", choosing, ChooseRow{PlayerID: "a", Row: -1}, ErrInvalidRow},
+		{"choose row past end", choosing, ChooseRow{PlayerID: "a", Row: RowCount}, ErrInvalidRow},
+		{"forfeit before deal", State{Status: StatusWaiting}, Forfeit{PlayerID: "a"}, ErrNotPlaying},
+		{"forfeit unknown player", base, Forfeit{PlayerID: "c"}, ErrNotInGame},
+		{"unknown action", base, nil, ErrUnknownAction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, events, err := Apply(tt.state, tt.action)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if events != nil {
+				t.Errorf("events = %#v, want none", events)
+			}
+			if !reflect.DeepEqual(got, tt.state) {
+				t.Errorf("state changed on error")
+			}
+		})
+	}
+}
+
+func TestPlayCardWaitsForEveryone(t *testing.T) {
+	rows := [RowCount]model.Row{row(10), row(20), row(30), row(40)}
+	s := playing(rows, map[string][]model.Card{"a": cards(11, 50), "b": cards(12, 60)})
+	s, events := mustApply(t, s, PlayCard{PlayerID: "a", Value: 11})
+	if !reflect.DeepEqual(events, []Event{CardSelected{PlayerID: "a"}}) {
+		t.Fatalf("events = %#v", events)
+	}
+	if len(s.Hands["a"]) != 2 || s.Selected["a"].Value != 11 {
+		t.Errorf("selection should hold the card without playing it: hand %v, selected %v", s.Hands["a"], s.Selected)
+	}
+	if got := rowValues(s.Rows[0]); len(got) != 1 {
+		t.Errorf("row 0 = %v before reveal", got)
+	}
+}
+
+func TestTurnResolution(t *testing.T) {
+	tests := []struct {
+		name       string
+		rows       [RowCount]model.Row
+		hands      map[string][]model.Card
+		plays      []Action
+		wantStatus string
+		wantRows   [RowCount][]int
+		wantScores map[string]int
+		wantPiles  map[string][]int
+		wantEvents []Event
+	}{
+		{
+			name:  "cards placed lowest first",
+			rows:  [RowCount]model.Row{row(10), row(20), row(30), row(40)},
+			hands: map[string][]model.Card{"a": cards(12, 90), "b": cards(11, 91)},
+			plays: []Action{
+				PlayCard{PlayerID: "a", Value: 12},
+				PlayCard{PlayerID: "b", Value: 11},
+			},
+			wantStatus: StatusPlaying,
+			wantRows:   [RowCount][]int{{10, 11, 12}, {20}, {30}, {40}},
+			wantScores: map[string]int{"a": 0, "b": 0},
+			wantEvents: []Event{
+				CardSelected{PlayerID: "b"},
+				TurnRevealed{Plays: []model.PlayAction{
+					{PlayerID: "b", Card: model.Card{Value: 11, Score: 5, OwnerID: "b"}},
+					{PlayerID: "a", Card: model.Card{Value: 12, Score: 1, OwnerID: "a"}},
+				}},
+				CardPlaced{PlayerID: "b", Card: model.Card{Value: 11, Score: 5, OwnerID: "b"}, Row: 0},
+				CardPlaced{PlayerID: "a", Card: model.Card{Value: 12, Score: 1, OwnerID: "a"}, Row: 0},
+				TurnResolved{},
+			},
+		},
+		{
+			name:  "sixth card takes the row",
+			rows:  [RowCount]model.Row{row(1, 2, 3, 4, 5), row(20), row(30), row(40)},
+			hands: map[string][]model.Card{"a": cards(6, 90), "b": cards(7, 91)},
+			plays: []Action{
+				PlayCard{PlayerID: "a", Value: 6},
+				PlayCard{PlayerID: "b", Value: 7},
+			},
+			wantStatus: StatusPlaying,
+			wantRows:   [RowCount][]int{{6, 7}, {20}, {30}, {40}},
+			wantScores: map[string]int{"a": 6, "b": 0},
+			wantPiles:  map[string][]int{"a": {1, 2, 3, 4, 5}},
+		},
+		{
+			name:  "last card finishes the game",
+			rows:  [RowCount]model.Row{row(10), row(20), row(30), row(40)},
+			hands: map[string][]model.Card{"a": cards(21), "b": cards(41)},
+			plays: []Action{
+				PlayCard{PlayerID: "a", Value: 21},
+				PlayCard{PlayerID: "b", Value: 41},
+			},
+			wantStatus: StatusFinished,
+			wantRows:   [RowCount][]int{{10}, {20, 21}, {30}, {40, 41}},
+			wantScores: map[string]int{"a": 0, "b": 0},
+		},
+		{
+			name:  "low card waits for a row choice",
+			rows:  [RowCount]model.Row{row(10), row(20), row(30), row(40)},
+			hands: map[string][]model.Card{"a": cards(5, 90), "b": cards(50, 91)},
+			plays: []Action{
+				PlayCard{PlayerID: "a", Value: 5},
+				PlayCard{PlayerID: "b", Value: 50},
+			},
+			wantStatus: StatusChoosingRow,
+			wantRows:   [RowCount][]int{{10}, {20}, {30}, {40}},
+			wantScores: map[string]int{"a": 0, "b": 0},
+		},
+		{
+			name:  "row choice then the rest of the queue",
+			rows:  [RowCount]model.Row{row(10), row(20, 22), row(30), row(40)},
+			hands: map[string][]model.Card{"a": cards(5, 90), "b": cards(50, 91)},
+			plays: []Action{
+				PlayCard{PlayerID: "a", Value: 5},
+				PlayCard{PlayerID: "b", Value: 50},
+				ChooseRow{PlayerID: "a", Row: 1},
+			},
+			wantStatus: StatusPlaying,
+			wantRows:   [RowCount][]int{{10}, {5}, {30}, {40, 50}},
+			wantScores: map[string]int{"a": 8, "b": 0},
+			wantPiles:  map[string][]int{"a": {20, 22}},
+			wantEvents: []Event{
+				RowTaken{PlayerID: "a", Card: model.Card{Value: 5, Score: 2, OwnerID: "a"}, Row: 1, Cards: cards(20, 22), Penalty: 8},
+				CardPlaced{PlayerID: "b", Card: model.Card{Value: 50, Score: 3, OwnerID: "b"}, Row: 3},
+				TurnResolved{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, events := mustApply(t, playing(tt.rows, tt.hands), tt.plays...)
+			if s.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", s.Status, tt.wantStatus)
+			}
+			for i, want := range tt.wantRows {
+				if got := rowValues(s.Rows[i]); !reflect.DeepEqual(got, want) {
+					t.Errorf("row %d = %v, want %v", i, got, want)
+				}
+			}
+			if !reflect.DeepEqual(s.Scores, tt.wantScores) {
+				t.Errorf("scores = %v, want %v", s.Scores, tt.wantScores)
+			}
+			piles := map[string][]int{}
+			for id, pile := range s.Piles {
+				piles[id] = rowValues(model.Row{Cards: pile})
+			}
+			if tt.wantPiles == nil {
+				tt.wantPiles = map[string][]int{}
+			}
+			if !reflect.DeepEqual(piles, tt.wantPiles) {
+				t.Errorf("piles = %v, want %v", piles, tt.wantPiles)
+			}
+			if tt.wantEvents != nil && !reflect.DeepEqual(events, tt.wantEvents) {
+				t.Errorf("events =\n%#v\nwant\n%#v", events, tt.wantEvents)
+			}
+			if len(s.Selected) != 0 {
+				t.Errorf("selections left after reveal: %v", s.Selected)
+			}
+		})
+	}
+}
+
+func TestForfeit(t *testing.T) {
+	rows := [RowCount]model.Row{row(10), row(20), row(30), row(40)}
+	hands := func() map[string][]model.Card {
+		return map[string][]model.Card{"a": cards(5, 90), "b": cards(50, 91), "c": cards(60, 92)}
+	}
+
+	t.Run("remaining players are no longer waited for", func(t *testing.T) {
+		s, events := mustApply(t, playing(rows, hands()),
+			PlayCard{PlayerID: "b", Value: 50}, PlayCard{PlayerID: "c", Value: 60}, Forfeit{PlayerID: "a"})
+		if _, ok := events[len(events)-1].(TurnResolved); !ok {
+			t.Fatalf("turn not resolved after the forfeit: %#v", events)
+		}
+		if got, ok := events[0].(PlayerForfeited); !ok || !reflect.DeepEqual(rowValues(model.Row{Cards: got.Discarded}), []int{5, 90}) {
+			t.Errorf("first event = %#v, want a forfeit discarding 5 and 90", events[0])
+		}
+		if len(s.Hands["a"]) != 0 || s.Revealed[len(s.Revealed)-1].Value == 5 {
+			t.Errorf("forfeited hand still in play: hand %v, revealed %v", s.Hands["a"], s.Revealed)
+		}
+	})
+
+	t.Run("pending row choice is dropped", func(t *testing.T) {
+		s, _ := mustApply(t, playing(rows, hands()),
+			PlayCard{PlayerID: "a", Value: 5}, PlayCard{PlayerID: "b", Value: 50}, PlayCard{PlayerID: "c", Value: 60})
+		if s.Status != StatusChoosingRow {
+			t.Fatalf("status = %q, want %q", s.Status, StatusChoosingRow)
+		}
+		s, _ = mustApply(t, s, Forfeit{PlayerID: "a"})
+		if s.Status != StatusPlaying || s.PendingPlay != nil {
+			t.Errorf("status = %q, pending %v; want the turn resolved", s.Status, s.PendingPlay)
+		}
+		if got := rowValues(s.Rows[3]); !reflect.DeepEqual(got, []int{40, 50, 60}) {
+			t.Errorf("row 4 = %v, want the rest of the queue placed", got)
+		}
+		if s.Scores["a"] != 0 || len(s.Piles["a"]) != 0 {
+			t.Errorf("forfeited player took a row: score %d, pile %v", s.Scores["a"], s.Piles["a"])
+		}
+	})
+
+	t.Run("revealed card is still placed", func(t *testing.T) {
+		s, _ := mustApply(t, playing(rows, hands()),
+			PlayCard{PlayerID: "a", Value: 5}, PlayCard{PlayerID: "b", Value: 50}, PlayCard{PlayerID: "c", Value: 60},
+			Forfeit{PlayerID: "c"}, ChooseRow{PlayerID: "a", Row: 0})
+		if got := rowValues(s.Rows[3]); !reflect.DeepEqual(got, []int{40, 50, 60}) {
+			t.Errorf("row 4 = %v, want 60 placed after the forfeit", got)
+		}
+		if len(s.Hands["c"]) != 0 {
+			t.Errorf("forfeited hand = %v, want empty", s.Hands["c"])
+		}
+	})
+
+	t.Run("everyone forfeits", func(t *testing.T) {
+		s, events := mustApply(t, playing(rows, hands()), Forfeit{PlayerID: "a"}, Forfeit{PlayerID: "b"}, Forfeit{PlayerID: "c"})
+		if s.Status != StatusFinished {
+			t.Errorf("status = %q, want %q", s.Status, StatusFinished)
+		}
+		if _, ok := events[len(events)-1].(GameFinished); !ok {
+			t.Errorf("last event = %#v, want GameFinished", events[len(events)-1])
+		}
+	})
+}
+
+func TestApplyDoesNotMutateInput(t *testing.T) {
+	rows := [RowCount]model.Row{row(1, 2, 3, 4, 5), row(20), row(30), row(40)}
+	s := playing(rows, map[string][]model.Card{"a": cards(6, 90), "b": cards(7, 91)})
+	s.Selected["b"] = model.Card{Value: 7, Score: 1}
+	before := s.Clone()
+	if _, _, err := Apply(s, PlayCard{PlayerID: "a", Value: 6}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, before) {
+		t.Errorf("Apply mutated its input state")
+	}
+}
+
+func TestFullGameIsDeterministic(t *testing.T) {
+	play := func() State {
+		s, _ := mustApply(t, State{}, Deal{Deck: NewDeck(), Players: []string{"a", "b", "c"}})
+		for s.Status != StatusFinished {
+			var a Action
+			if s.Status == StatusChoosingRow {
+				a = ChooseRow{PlayerID: s.PendingPlay.PlayerID, Row: 0}
+			} else {
+				for _, id := range []string{"a", "b", "c"} {
+					if _, ok := s.Selected[id]; !ok {
+						// Highest card first to force overflows.
+						a = PlayCard{PlayerID: id, Value: s.Hands[id][len(s.Hands[id])-1].Value}
+						break
+					}
+				}
+			}
+			s, _ = mustApply(t, s, a)
+		}
+		return s
+	}
+	first, second := play(), play()
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("same deal and plays gave different results:\n%v\n%v", first.Scores, second.Scores)
+	}
+	for id, score := range first.Scores {
+		if pile := CalculateRowScore(model.Row{Cards: first.Piles[id]}); pile != score {
+			t.Errorf("%s scored %d but the pile holds %d bullheads", id, score, pile)
+		}
+	}
+	if want := RowCount + 3*HandSize; len(first.Revealed) != want {
+		t.Errorf("revealed %d cards, want %d", len(first.Revealed), want)
+	}
+	for id, hand := range first.Hands {
+		if len(hand) != 0 {
+			t.Errorf("hand %s not empty at the end: %v", id, hand)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package engine
+
+import "take5/internal/model"
+
+// Event describes something that happened while applying an action, in the
+// order it happened. Callers translate events into their own output.
+type Event interface {
+	isEvent()
+}
+
+// GameStarted is emitted when a deal hands out cards; Players is the deal order.
+type GameStarted struct {
+	Players []string
+}
+
+// CardSelected is emitted when a player commits a card for the current turn.
+type CardSelected struct {
+	PlayerID string
+}
+
+// TurnRevealed is emitted once every active player has selected a card;
+// Plays are in the order they will be placed.
+type TurnRevealed struct {
+	Plays []model.PlayAction
+}
+
+// CardPlaced is emitted when a card is appended to a row.
+type CardPlaced struct {
+	PlayerID string
+	Card     model.Card
+	Row      int
+}
+
+// RowTaken is emitted when a player collects a row, either because their
+// card was the sixth (Overflow) or because they chose it. Cards are the
+// collected cards, which now start the player's penalty pile.
+type RowTaken struct {
+	PlayerID string
+	Card     model.Card
+	Row      int
+	Cards    []model.Card
+	Penalty  int
+	Overflow bool
+}
+
+// RowChoiceNeeded is emitted when a card is lower than every row end and its
+// owner must pick a row to take.
+type RowChoiceNeeded struct {
+	PlayerID string
+	Card     model.Card
+}
+
+// PlayerForfeited is emitted when a player withdraws; Discarded is the hand
+// they still held, which leaves the game unplayed.
+type PlayerForfeited struct {
+	PlayerID  string
+	Discarded []model.Card
+}
+
+// TurnResolved is emitted when every card of the turn has been placed and
+// the game continues.
+type TurnResolved struct{}
+
+// GameFinished is emitted when the last card has been placed.
+type GameFinished struct {
+	Scores map[string]int
+}
+
+func (GameStarted) isEvent()     {}
+func (CardSelected) isEvent()    {}
+func (TurnRevealed) isEvent()    {}
+func (CardPlaced) isEvent()      {}
+func (RowTaken) isEvent()        {}
+func (RowChoiceNeeded) isEvent() {}
+func (PlayerForfeited) isEvent() {}
+func (TurnResolved) isEvent()    {}
+func (GameFinished) isEvent()    {}
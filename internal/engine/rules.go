@@ -0,0 +1,69 @@
+package engine
+
+import "take5/internal/model"
+
+const (
+	DeckSize     = 104
+	HandSize     = 10
+	RowCount     = 4
+	MaxRowLength = 5 // 第 6 张牌放入时收走整行
+	// MaxPlayers is the most hands one deck can deal: 104 cards minus the
+	// four row starters leave ten hands of ten.
+	MaxPlayers = (DeckSize - RowCount) / HandSize
+)
+
+// GetScore calculates the penalty score (bullheads) for a given card value.
+func GetScore(val int) int {
+	if val == 55 {
+		return 7
+	}
+	if val%11 == 0 {
+		return 5
+	}
+	if val%10 == 0 {
+		return 3
+	}
+	if val%5 == 0 {
+		return 2
+	}
+	return 1
+}
+
+// NewDeck returns the 104 cards in ascending order.
+func NewDeck() []model.Card {
+	deck := make([]model.Card, 0, DeckSize)
+	for i := 1; i <= DeckSize; i++ {
+		deck = append(deck, model.Card{Value: i, Score: GetScore(i)})
+	}
+	return deck
+}
+
+// FindBestRow finds the optimal row index for a card placement.
+// Returns -1 if no valid row is found (card is smaller than all row ends).
+func FindBestRow(rows [RowCount]model.Row, cardValue int) (int, int) {
+	bestRowIdx := -1
+	diff := 1000
+	for i := 0; i < RowCount; i++ {
+		if len(rows[i].Cards) == 0 {
+			continue
+		}
+		lastCard := rows[i].Cards[len(rows[i].Cards)-1]
+		if cardValue > lastCard.Value {
+			d := cardValue - lastCard.Value
+			if d < diff {
+				diff = d
+				bestRowIdx = i
+			}
+		}
+	}
+	return bestRowIdx, diff
+}
+
+// CalculateRowScore computes the total penalty score of a row.
+func CalculateRowScore(row model.Row) int {
+	score := 0
+	for _, c := range row.Cards {
+		score += c.Score
+	}
+	return score
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"take5/internal/model"
+	"testing"
+)
+
+func row(values ...int) model.Row {
+	r := model.Row{Cards: []model.Card{}}
+	for _, v := range values {
+		r.Cards = append(r.Cards, model.Card{Value: v, Score: GetScore(v)})
+	}
+	return r
+}
+
+func TestGetScore(t *testing.T) {
+	tests := []struct {
+		card int
+		want int
+	}{
+		{1, 1},
+		{4, 1},
+		{5, 2},
+		{15, 2},
+		{10, 3},
+		{100, 3},
+		{11, 5},
+		{99, 5},
+		{55, 7},
+		{104, 1},
+	}
+	for _, tt := range tests {
+		if got := GetScore(tt.card); got != tt.want {
+			t.Errorf("GetScore(%d) = %d, want %d", tt.card, got, tt.want)
+		}
+	}
+}
+
+func TestNewDeck(t *testing.T) {
+	deck := NewDeck()
+	if len(deck) != DeckSize {
+		t.Fatalf("len(deck) = %d, want %d", len(deck), DeckSize)
+	}
+	total := 0
+	for i, c := range deck {
+		if c.Value != i+1 {
+			t.Fatalf("deck[%d] = %d, want %d", i, c.Value, i+1)
+		}
+		total += c.Score
+	}
+	// The published total of bullheads in a 6 nimmt! deck.
+	if total != 171 {
+		t.Errorf("total bullheads = %d, want 171", total)
+	}
+}
+
+func TestFindBestRow(t *testing.T) {
+	rows := [RowCount]model.Row{row(10), row(20, 25), row(40), row(3)}
+	tests := []struct {
+		name     string
+		rows     [RowCount]model.Row
+		card     int
+		wantRow  int
+		wantDiff int
+	}{
+		{"closest lower end", rows, 27, 1, 2},
+		{"just above smallest end", rows, 4, 3, 1},
+		{"above every end", rows, 104, 2, 64},
+		{"between ends", rows, 12, 0, 2},
+		{"below every end", rows, 2, -1, 1000},
+		{"empty rows are skipped", [RowCount]model.Row{row(), row(50), row(), row()}, 51, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRow, gotDiff := FindBestRow(tt.rows, tt.card)
+			if gotRow != tt.wantRow || gotDiff != tt.wantDiff {
+				t.Errorf("FindBestRow(%d) = (%d, %d), want (%d, %d)", tt.card, gotRow, gotDiff, tt.wantRow, tt.wantDiff)
+			}
+		})
+	}
+}
+
+func TestCalculateRowScore(t *testing.T) {
+	tests := []struct {
+		row  model.Row
+		want int
+	}{
+		{row(), 0},
+		{row(1), 1},
+		{row(5, 10, 11, 55), 17},
+		{row(1, 2, 3, 4, 5), 6},
+	}
+	for _, tt := range tests {
+		if got := CalculateRowScore(tt.row); got != tt.want {
+			t.Errorf("CalculateRowScore(%v) = %d, want %d", tt.row.Cards, got, tt.want)
+		}
+	}
+}
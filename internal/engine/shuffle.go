@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The shuffle behind every deal. Rooms and the simulator both draw their
+// decks from it, so a seed deals the same cards wherever it is played; the
+// browser reimplements it to verify deals (see static/js/fair.js).
+
+// DealRNG is a deterministic random stream: the n-th 32-byte block is
+// sha256(key || uint32be(n)), read as big-endian uint32 words.
+type DealRNG struct {
+	key     [32]byte
+	counter uint32
+	buf     []byte
+}
+
+// NewDealRNG returns the stream for a shuffle key.
+func NewDealRNG(key [32]byte) *DealRNG {
+	return &DealRNG{key: key}
+}
+
+// Uint32 returns the next word of the stream.
+func (g *DealRNG) Uint32() uint32 {
+	if len(g.buf) < 4 {
+		var block [36]byte
+		copy(block[:32], g.key[:])
+		binary.BigEndian.PutUint32(block[32:], g.counter)
+		g.counter++
+		sum := sha256.Sum256(block[:])
+		g.buf = sum[:]
+	}
+	v := binary.BigEndian.Uint32(g.buf)
+	g.buf = g.buf[4:]
+	return v
+}
+
+// Intn returns a uniform value in [0, n) using rejection sampling.
+func (g *DealRNG) Intn(n int) int {
+	limit := uint64(1<<32) - uint64(1<<32)%uint64(n)
+	for {
+		if v := uint64(g.Uint32()); v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
+
+// Shuffle performs a Fisher–Yates shuffle from the last index down.
+func (g *DealRNG) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, g.Intn(i+1))
+	}
+}
+
+// ShuffleKey derives the shuffle key from the server seed and the client
+// seeds: sha256("<seed>|<id>=<clientSeed>|..."), with ids in sorted order.
+func ShuffleKey(seed int64, clientSeeds map[string]string) [32]byte {
+	var b strings.Builder
+	b.WriteString(strconv.FormatInt(seed, 10))
+	ids := make([]string, 0, len(clientSeeds))
+	for id := range clientSeeds {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		fmt.Fprintf(&b, "|%s=%s", id, clientSeeds[id])
+	}
+	return sha256.Sum256([]byte(b.String()))
+}
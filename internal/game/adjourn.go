@@ -0,0 +1,141 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"take5/internal/model"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// StatusAdjourned is the status of a room whose game was put aside to be
+// finished another day. Like a paused game, the status it came from is kept
+// in Room.PausedStatus.
+const StatusAdjourned = "adjourned"
+
+var (
+	ErrNotAdjournable = errors.New("只有进行中或暂停的对局可以休会")
+	ErrAdjournOwner   = errors.New("只有房主可以直接休会，其他玩家可以发起投票")
+)
+
+// participants returns the players an adjourned game has to wait for: those
+// dealt in who still hold cards and have not left for good.
+func participants(r *model.Room) []string {
+	ids := []string{}
+	for _, id := range r.Deal.DealOrder {
+		if p, ok := r.Players[id]; ok && !p.Departed && len(p.Hand) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Adjourn saves the running game so everyone can leave. It resumes by
+// itself once every participant is back in the room; departure policies
+// and grace periods are off in the meantime.
+// r 此时必须在外部被锁
+func (m *Manager) Adjourn(r *model.Room) error {
+	if !inProgress(r) && r.Status != StatusPaused {
+		return ErrNotAdjournable
+	}
+	if r.Status != StatusPaused {
+		r.PausedStatus = r.Status
+	}
+	r.Status = StatusAdjourned
+	r.Participants = participants(r)
+	g := model.SavedGame{RoomID: r.ID, Participants: r.Participants, AdjournedAt: time.Now()}
+	for _, id := range r.Participants {
+		g.Names = append(g.Names, playerName(r, id))
+	}
+	m.Store.SaveGame(g, r)
+	BroadcastInfo(r, "对局已休会，大家可以先离开，所有参与者回到房间后自动继续")
+	m.BroadcastState(r)
+	go m.BroadcastSavedGames()
+	return nil
+}
+
+// OwnerAdjourn adjourns the game at the owner's request.
+// r 此时必须在外部被锁
+func (m *Manager) OwnerAdjourn(r *model.Room, requesterID string) error {
+	if r.OwnerID != requesterID {
+		return ErrAdjournOwner
+	}
+	return m.Adjourn(r)
+}
+
+// ResumeAdjourned continues an adjourned game if every participant is
+// connected to the room again.
+// r 此时必须在外部被锁
+func (m *Manager) ResumeAdjourned(r *model.Room) bool {
+	if r.Status != StatusAdjourned {
+		return false
+	}
+	for _, id := range r.Participants {
+		// IsOnline survives a server restart, a connection does not.
+		if p, ok := r.Players[id]; !ok || p.Conn == nil {
+			return false
+		}
+	}
+	r.Status, r.PausedStatus, r.Participants = r.PausedStatus, "", nil
+	m.startTurnClock(r)
+	m.Store.DeleteSavedGame(r.ID)
+	BroadcastInfo(r, "参与者已全部回到房间，对局继续")
+	m.BroadcastState(r)
+	go m.BroadcastSavedGames()
+	m.actForDeparted(r)
+	return true
+}
+
+// dropAdjournment forgets the saved game of an adjourned room that is being
+// restarted or aborted instead of resumed.
+// r 此时必须在外部被锁
+func (m *Manager) dropAdjournment(r *model.Room) {
+	if r.Status != StatusAdjourned {
+		return
+	}
+	r.Participants = nil
+	m.Store.DeleteSavedGame(r.ID)
+	go m.BroadcastSavedGames()
+}
+
+// releaseParticipant stops an adjourned game from waiting for a player who
+// can no longer come back, and resumes it if nobody else is missing.
+// r 此时必须在外部被锁
+func (m *Manager) releaseParticipant(r *model.Room, playerID string) {
+	if r.Status != StatusAdjourned || !slices.Contains(r.Participants, playerID) {
+		return
+	}
+	r.Participants = slices.DeleteFunc(r.Participants, func(id string) bool { return id == playerID })
+	if p, ok := r.Players[playerID]; ok {
+		p.Departed = true
+		BroadcastInfo(r, fmt.Sprintf("休会的对局不再等待 %s，继续后按房间设置%s", p.Name, departureNames[departurePolicy(r.Settings)]))
+	}
+	m.ResumeAdjourned(r)
+}
+
+// BroadcastSavedGames sends every identified lobby user the adjourned games
+// they take part in.
+func (m *Manager) BroadcastSavedGames() {
+	games := m.Store.SavedGames()
+	m.LobbyLock.Lock()
+	defer m.LobbyLock.Unlock()
+	for conn, u := range m.LobbyConns {
+		if u.ID != "" {
+			sendSavedGames(conn, u.ID, games)
+		}
+	}
+}
+
+// sendSavedGames writes the games among games that userID takes part in.
+// LobbyLock must be held.
+func sendSavedGames(conn *websocket.Conn, userID string, games []model.SavedGame) {
+	mine := make([]model.SavedGame, 0)
+	for _, g := range games {
+		if slices.Contains(g.Participants, userID) {
+			mine = append(mine, g)
+		}
+	}
+	writeLobby(conn, model.Message{Type: "adjourned_games", Payload: mine})
+}
@@ -0,0 +1,40 @@
+package game
+
+import (
+	"errors"
+	"take5/internal/bot"
+	"take5/internal/model"
+)
+
+var (
+	ErrAdvisorDisabled = errors.New("本房间已关闭出牌提示")
+	ErrNothingToAdvise = errors.New("现在没有需要出的牌")
+)
+
+// Advise ranks the cards in playerID's hand by their estimated risk this
+// turn, from what that player can see. r 此时必须在外部被锁
+func (m *Manager) Advise(r *model.Room, playerID string) ([]model.CardAdvice, error) {
+	if r.Settings.NoAdvisor {
+		return nil, ErrAdvisorDisabled
+	}
+	p, ok := r.Players[playerID]
+	if !ok {
+		return nil, ErrNotInRoom
+	}
+	if r.Status != "playing" || p.SelectedCard != nil || len(p.Hand) == 0 {
+		return nil, ErrNothingToAdvise
+	}
+	return bot.Advise(bot.ViewOf(engineState(r), playerID)), nil
+}
+
+// unseenView is the card tracker payload for playerID, or nil when the room
+// has the tracker off or the player has no cards left to play.
+// r 此时必须在外部被锁
+func unseenView(r *model.Room, playerID string) *model.UnseenView {
+	p, ok := r.Players[playerID]
+	if !ok || !r.Settings.CardTracker || len(p.Hand) == 0 || (r.Status != "playing" && r.Status != "choosing_row") {
+		return nil
+	}
+	t := bot.Track(bot.ViewOf(engineState(r), playerID))
+	return &t
+}
@@ -2,32 +2,69 @@ package game
 
 import (
 	"encoding/json"
+	"log/slog"
 	"sort"
+	"sync"
+	"take5/internal/metrics"
 	"take5/internal/model"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 // BroadcastState sends the current room state to all players in the room.
 func (m *Manager) BroadcastState(r *model.Room) {
+	start := time.Now()
 	publicPlayers := make(map[string]interface{})
 	for id, p := range r.Players {
 		publicPlayers[id] = map[string]interface{}{
 			"id": p.ID, "name": p.Name, "score": p.Score, "ready": p.Ready,
 			"hasSelected": p.SelectedCard != nil, "handSize": len(p.Hand),
-			"isOwner": (id == r.OwnerID),
-			"isOnline": p.IsOnline,
+			"pile":          p.Pile,
+			"isOwner":       (id == r.OwnerID),
+			"isOnline":      p.IsOnline,
+			"botControlled": botControlled(r, p),
+			"botAssisted":   p.BotAssisted,
+			"waiting":       waiting(r, id),
+			"sittingOut":    p.SittingOut,
+			"host":          p.Host,
 		}
 	}
 	stateMap := map[string]interface{}{
 		"rows": r.Rows, "status": r.Status, "players": publicPlayers,
 		"pendingPlayerId": "", "pendingCard": nil, "ownerId": r.OwnerID,
 	}
+	// Seeds reveal every hand: the running game only shows its commitments,
+	// the next game only its seed commitment, and finished deals are public.
+	stateMap["seedCommit"] = SeedCommit(upcomingSeed(r))
+	stateMap["seedFixed"] = r.SeedFixed
+	stateMap["dealSeedCommit"] = r.Deal.SeedCommit
+	stateMap["deckCommit"] = r.Deal.DeckCommit
+	stateMap["lastDeal"] = r.LastDeal
+	stateMap["settings"] = r.Settings
+	stateMap["waitingList"] = r.WaitingList
+	stateMap["vote"] = r.Vote
+	stateMap["participants"] = r.Participants
+	stateMap["rematch"] = r.Rematch
+	stateMap["series"] = r.Series
+	if !r.TurnDeadline.IsZero() {
+		stateMap["turnDeadline"] = r.TurnDeadline
+	}
+	if r.TournamentID != "" {
+		stateMap["tournament"] = map[string]interface{}{"id": r.TournamentID, "entrants": r.Entrants}
+	}
+	if r.DuplicateID != "" {
+		stateMap["duplicate"] = map[string]interface{}{
+			"id": r.DuplicateID, "board": r.Board, "seatOrder": r.SeatOrder,
+		}
+	}
 	if r.PendingPlay != nil {
 		stateMap["pendingPlayerId"] = r.PendingPlay.PlayerID
 		stateMap["pendingCard"] = r.PendingPlay.Card
 	}
 
+	// A connection holding several seats gets one state per seat; only the
+	// seat its device is handed to sees its hand.
 	for _, p := range r.Players {
 		if p.Conn != nil {
 			payload := map[string]interface{}{
@@ -35,40 +72,82 @@ func (m *Manager) BroadcastState(r *model.Room) {
 				"myHand":      p.Hand,
 				"roomId":      r.ID,
 			}
-			if p.SelectedCard != nil {
-				payload["mySelectedCard"] = p.SelectedCard.Value
+			hidden := false
+			if seats := seatsOf(r, hostOf(p)); len(seats) > 1 {
+				active := activeSeat(r, hostOf(p))
+				payload["seat"] = p.ID
+				payload["seats"] = seats
+				payload["activeSeat"] = active
+				hidden = p.ID != active
+			}
+			if hidden {
+				payload["myHand"] = []model.Card{}
+				payload["hidden"] = true
+			} else {
+				if p.SelectedCard != nil {
+					payload["mySelectedCard"] = p.SelectedCard.Value
+				}
+				if seed, ok := r.ClientSeeds[p.ID]; ok {
+					payload["myClientSeed"] = seed
+				}
+				if unseen := unseenView(r, p.ID); unseen != nil {
+					payload["unseen"] = unseen
+				}
 			}
 
-			p.Conn.WriteJSON(model.Message{Type: "state", Payload: payload})
+			send(r, p.ID, p.Conn, model.Message{Type: "state", Payload: payload})
 		}
 	}
+	for _, sp := range r.Spectators {
+		payload := map[string]interface{}{
+			"publicState": stateMap,
+			"myHand":      []model.Card{},
+			"roomId":      r.ID,
+			"spectator":   true,
+		}
+		send(r, sp.ID, sp.Conn, model.Message{Type: "state", Payload: payload})
+	}
+	metrics.ObserveSince(metrics.BroadcastDuration.WithLabelValues("state"), start)
 
+	Touch(r)
 	m.Store.PersistRoom(r)
 	go m.BroadcastRoomList()
 }
 
 // BroadcastInfo sends a text notification to all players in the room.
 func BroadcastInfo(r *model.Room, text string) {
+	start := time.Now()
 	for _, p := range r.Players {
-		if p.Conn != nil {
-			p.Conn.WriteJSON(model.Message{Type: "info", Payload: text})
+		if p.Conn != nil && !guest(p) {
+			send(r, p.ID, p.Conn, model.Message{Type: "info", Payload: text})
 		}
 	}
+	for _, sp := range r.Spectators {
+		send(r, sp.ID, sp.Conn, model.Message{Type: "info", Payload: text})
+	}
+	metrics.ObserveSince(metrics.BroadcastDuration.WithLabelValues("info"), start)
 }
 
 // BroadcastStats sends the historical game statistics to all players in the room.
 func (m *Manager) BroadcastStats(r *model.Room) {
 	stats := m.Store.GetRoomStats(r.ID)
 	for _, p := range r.Players {
-		if p.Conn != nil {
-			p.Conn.WriteJSON(model.Message{Type: "stats", Payload: stats})
+		if p.Conn != nil && !guest(p) {
+			send(r, p.ID, p.Conn, model.Message{Type: "stats", Payload: stats})
 		}
 	}
+	for _, sp := range r.Spectators {
+		send(r, sp.ID, sp.Conn, model.Message{Type: "stats", Payload: stats})
+	}
 }
 
-// BroadcastRoomList sends the list of active rooms to all users in the lobby.
+// BroadcastRoomList sends the list of active rooms, together with the
+// presence list of online users, to all users in the lobby.
 func (m *Manager) BroadcastRoomList() {
 	list := make([]model.RoomSummary, 0)
+	statusCounts := make(map[string]int)
+	inRoom := make(map[string]model.PresenceEntry)
+	moves := make(map[string][]model.YourMove) // 每位玩家轮到自己的通信对局
 	m.RoomsLock.Lock()
 	for id, r := range m.Rooms {
 		r.Mutex.Lock()
@@ -80,24 +159,111 @@ func (m *Manager) BroadcastRoomList() {
 			ownerName = "无房主"
 		}
 
-		list = append(list, model.RoomSummary{
+		summary := model.RoomSummary{
 			ID:          id,
 			OwnerName:   ownerName,
 			PlayerCount: len(r.Players),
 			Status:      r.Status,
-		})
+			Duplicate:   r.DuplicateID,
+			Tournament:  r.TournamentID,
+
+			Correspondence: r.Settings.Correspondence,
+		}
+		if r.StaleWarned && m.Janitor.TTL > 0 {
+			summary.ExpiresAt = r.LastActive.Add(m.Janitor.TTL).Unix()
+		}
+		list = append(list, summary)
+		statusCounts[r.Status]++
+		for pid, p := range r.Players {
+			if p.Conn != nil {
+				inRoom[pid] = model.PresenceEntry{ID: pid, Name: p.Name, RoomID: id}
+			}
+		}
+		for sid, sp := range r.Spectators {
+			if _, ok := inRoom[sid]; !ok {
+				inRoom[sid] = model.PresenceEntry{ID: sid, Name: sp.Name, RoomID: id}
+			}
+		}
+		for _, pid := range awaitedPlayers(r) {
+			moves[pid] = append(moves[pid], model.YourMove{RoomID: id, Status: r.Status, Deadline: r.TurnDeadline})
+		}
 		r.Mutex.Unlock()
 	}
 	m.RoomsLock.Unlock()
 
+	metrics.RoomsByStatus.Reset()
+	for status, n := range statusCounts {
+		metrics.RoomsByStatus.WithLabelValues(status).Set(float64(n))
+	}
+
 	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
 
 	msg := model.Message{Type: "room_list", Payload: list}
-	msgBytes, _ := json.Marshal(msg)
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("failed to marshal room list", "err", err)
+		return
+	}
 
+	start := time.Now()
 	m.LobbyLock.Lock()
-	for conn := range m.LobbyConns {
-		conn.WriteMessage(websocket.TextMessage, msgBytes)
+	presence := model.Message{Type: "presence", Payload: m.buildPresence(inRoom)}
+	for conn, u := range m.LobbyConns {
+		if err := writeRaw(conn, msgBytes); err != nil {
+			metrics.Errors.WithLabelValues(metrics.SourceWebSocketWrite).Inc()
+			slog.Warn("failed to write room list", "remote_addr", conn.RemoteAddr().String(), "err", err)
+			continue
+		}
+		writeLobby(conn, presence)
+		if u.ID != "" {
+			mine := moves[u.ID]
+			if mine == nil {
+				mine = []model.YourMove{}
+			}
+			sortMoves(mine)
+			writeLobby(conn, model.Message{Type: "your_move", Payload: mine})
+		}
 	}
 	m.LobbyLock.Unlock()
+	metrics.ObserveSince(metrics.BroadcastDuration.WithLabelValues("room_list"), start)
+}
+
+// send writes a message to one player's or spectator's connection, logging
+// and counting failed writes.
+func send(r *model.Room, id string, conn *websocket.Conn, msg model.Message) {
+	if err := WriteJSON(conn, msg); err != nil {
+		metrics.Errors.WithLabelValues(metrics.SourceWebSocketWrite).Inc()
+		roomLogger(r).Warn("failed to write to player", "player_id", id, "msg_type", msg.Type, "err", err)
+	}
+}
+
+// connLocks holds one write lock per connection. gorilla/websocket allows a
+// single concurrent writer, but a connection is written to by its own
+// handler as well as by broadcasts running under other locks.
+var connLocks sync.Map // *websocket.Conn -> *sync.Mutex
+
+// WriteJSON writes v to conn, serialised with every other write to it.
+func WriteJSON(conn *websocket.Conn, v interface{}) error {
+	mu, _ := connLocks.LoadOrStore(conn, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+	return conn.WriteJSON(v)
+}
+
+// writeRaw writes an already encoded text message to conn.
+func writeRaw(conn *websocket.Conn, data []byte) error {
+	mu, _ := connLocks.LoadOrStore(conn, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// ReleaseConn forgets the write lock of a closed connection.
+func ReleaseConn(conn *websocket.Conn) {
+	connLocks.Delete(conn)
+}
+
+// roomLogger returns the default logger with the room ID attached.
+func roomLogger(r *model.Room) *slog.Logger {
+	return slog.With("room_id", r.ID)
 }
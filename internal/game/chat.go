@@ -0,0 +1,139 @@
+package game
+
+import (
+	"errors"
+	"strings"
+	"take5/internal/model"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	MaxChatLength    = 200              // 单条聊天的最大字符数
+	ChatHistorySize  = 50               // 加入房间时下发的历史条数
+	chatRateLimit    = 5                // 每个窗口内最多发送条数
+	chatRateInterval = 10 * time.Second // 限流窗口
+)
+
+// Emotes maps the emote keys clients may send to the text shown in chat.
+var Emotes = map[string]string{
+	"thumbs_up": "👍",
+	"laugh":     "😂",
+	"cry":       "😭",
+	"angry":     "😠",
+	"clap":      "👏",
+	"cow":       "🐮",
+}
+
+// ChatModerator inspects a chat line before it is stored and broadcast. It
+// may rewrite the text, or reject it with an error that is shown to the sender.
+type ChatModerator func(senderID, text string) (string, error)
+
+// BlocklistModerator masks every occurrence of the given words with asterisks.
+func BlocklistModerator(words []string) ChatModerator {
+	return func(senderID, text string) (string, error) {
+		for _, w := range words {
+			if w == "" {
+				continue
+			}
+			text = strings.ReplaceAll(text, w, strings.Repeat("*", utf8.RuneCountInString(w)))
+		}
+		return text, nil
+	}
+}
+
+var (
+	ErrChatEmpty       = errors.New("消息不能为空")
+	ErrChatTooLong     = errors.New("消息太长了")
+	ErrChatRateLimited = errors.New("发言太快了，请稍后再试")
+	ErrUnknownEmote    = errors.New("未知的表情")
+	ErrNotInRoom       = errors.New("只有房间内的玩家可以发言")
+	ErrNotIdentified   = errors.New("请先输入昵称")
+)
+
+// HandleChat validates, stores and broadcasts a chat line or emote from a
+// player. kind is "chat" or "emote"; for emotes text is the emote key.
+// r 此时必须在外部被锁
+func (m *Manager) HandleChat(r *model.Room, playerID, kind, text string) error {
+	player := r.Players[playerID]
+	if player == nil {
+		return ErrNotInRoom
+	}
+
+	switch kind {
+	case "emote":
+		emote, ok := Emotes[text]
+		if !ok {
+			return ErrUnknownEmote
+		}
+		text = emote
+	default:
+		kind = "chat"
+		var err error
+		if text, err = m.checkChatText(playerID, text); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if !allowChat(&player.RecentChats, now) {
+		return ErrChatRateLimited
+	}
+
+	msg := model.ChatMessage{PlayerID: player.ID, Name: player.Name, Kind: kind, Text: text, SentAt: now.UnixMilli()}
+	m.Store.SaveChatMessage(r.ID, msg)
+	Touch(r)
+
+	out := model.Message{Type: "chat", Payload: msg}
+	for _, p := range r.Players {
+		if p.Conn != nil && !guest(p) {
+			send(r, p.ID, p.Conn, out)
+		}
+	}
+	for _, sp := range r.Spectators {
+		send(r, sp.ID, sp.Conn, out)
+	}
+	return nil
+}
+
+// checkChatText trims and length-checks a chat line, then runs it through the
+// configured moderators.
+func (m *Manager) checkChatText(senderID, text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", ErrChatEmpty
+	}
+	if utf8.RuneCountInString(text) > MaxChatLength {
+		return "", ErrChatTooLong
+	}
+	for _, moderate := range m.Moderators {
+		var err error
+		if text, err = moderate(senderID, text); err != nil {
+			return "", err
+		}
+	}
+	return text, nil
+}
+
+// allowChat applies a sliding-window rate limit to a sender's messages.
+func allowChat(history *[]time.Time, now time.Time) bool {
+	recent := (*history)[:0]
+	for _, t := range *history {
+		if now.Sub(t) < chatRateInterval {
+			recent = append(recent, t)
+		}
+	}
+	*history = recent
+	if len(recent) >= chatRateLimit {
+		return false
+	}
+	*history = append(*history, now)
+	return true
+}
+
+// SendChatHistory sends the room's recent chat to a single connection.
+func (m *Manager) SendChatHistory(r *model.Room, id string, conn *websocket.Conn) {
+	send(r, id, conn, model.Message{Type: "chat_history", Payload: m.Store.GetChatHistory(r.ID, ChatHistorySize)})
+}
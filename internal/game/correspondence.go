@@ -0,0 +1,85 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"take5/internal/engine"
+	"take5/internal/model"
+	"time"
+)
+
+// DefaultTurnDeadline is Manager.TurnDeadline unless configured.
+const DefaultTurnDeadline = 24 * time.Hour
+
+var ErrCorrespondenceInGame = errors.New("对局进行中不能切换通信对局模式")
+
+// overdue reports whether a correspondence game has waited for moves past
+// its turn deadline.
+func overdue(r *model.Room) bool {
+	return r.Settings.Correspondence && inProgress(r) && !r.TurnDeadline.IsZero() && !time.Now().Before(r.TurnDeadline)
+}
+
+// startTurnClock gives the players of a correspondence game a fresh
+// deadline for the moves the game now waits on. Other rooms have none.
+// r 此时必须在外部被锁
+func (m *Manager) startTurnClock(r *model.Room) {
+	if !r.Settings.Correspondence || !inProgress(r) {
+		r.TurnDeadline = time.Time{}
+		return
+	}
+	r.TurnDeadline = time.Now().Add(m.TurnDeadline)
+	m.scheduleTurnDeadline(r)
+}
+
+// scheduleTurnDeadline plays for everyone still missing a move once the
+// room's current turn deadline passes. A deadline replaced in the meantime
+// has its own timer.
+func (m *Manager) scheduleTurnDeadline(r *model.Room) {
+	deadline := r.TurnDeadline
+	time.AfterFunc(time.Until(deadline), func() {
+		r.Mutex.Lock()
+		defer r.Mutex.Unlock()
+		if r.Deleted {
+			return
+		}
+		if r.TurnDeadline.Equal(deadline) && overdue(r) && departedAction(r, engineState(r)) != nil {
+			BroadcastInfo(r, "本回合已到截止时间，未出牌的玩家自动出最小的牌")
+			m.actForDeparted(r)
+		}
+	})
+}
+
+// awaitedPlayers returns the players a correspondence game is waiting on.
+func awaitedPlayers(r *model.Room) []string {
+	ids := []string{}
+	if !r.Settings.Correspondence {
+		return ids
+	}
+	switch r.Status {
+	case engine.StatusChoosingRow:
+		if r.PendingPlay != nil {
+			ids = append(ids, r.PendingPlay.PlayerID)
+		}
+	case engine.StatusPlaying:
+		for _, id := range r.Deal.DealOrder {
+			if p, ok := r.Players[id]; ok && !p.Departed && p.SelectedCard == nil && len(p.Hand) > 0 {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// sortMoves orders a player's correspondence games by how soon they are due.
+func sortMoves(moves []model.YourMove) {
+	sort.Slice(moves, func(i, j int) bool { return moves[i].Deadline.Before(moves[j].Deadline) })
+}
+
+// durationText writes a turn deadline the way players think of it.
+func durationText(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d 小时", d/time.Hour)
+	}
+	return d.String()
+}
@@ -0,0 +1,194 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"take5/internal/bot"
+	"take5/internal/engine"
+	"take5/internal/model"
+	"time"
+)
+
+// Departure policies decide what happens to the seat of a player who goes
+// offline during a game, so the table is never left waiting for them.
+const (
+	DepartureLowest  = "lowest"  // 自动打出最小的牌，需要选行时收走牛头最少的行
+	DepartureBot     = "bot"     // 由机器人接替出牌和选行
+	DepartureForfeit = "forfeit" // 弃权，剩余手牌作废
+)
+
+// substituteStrategy is the bot that plays for departed players under
+// DepartureBot.
+const substituteStrategy = "cautious"
+
+// DefaultDepartureGrace is Manager.DepartureGrace unless configured.
+const DefaultDepartureGrace = 30 * time.Second
+
+var ErrUnknownDeparture = errors.New("未知的离场处理方式")
+
+var departureNames = map[string]string{
+	DepartureLowest:  "自动出最小的牌",
+	DepartureBot:     "机器人代打",
+	DepartureForfeit: "弃权并作废手牌",
+}
+
+// departurePolicy returns the policy of settings. Unless the room chose
+// otherwise, a bot plays for whoever left or stayed disconnected past the
+// grace period.
+func departurePolicy(s model.RoomSettings) string {
+	if s.Departure == "" {
+		return DepartureBot
+	}
+	return s.Departure
+}
+
+// departed reports whether a dealt-in player has left the table. A player
+// who only lost their connection counts once the grace period is over.
+func departed(r *model.Room, playerID string) bool {
+	p, ok := r.Players[playerID]
+	return !ok || p.Departed
+}
+
+// botControlled reports whether the departure policy is playing p's seat.
+func botControlled(r *model.Room, p *model.Player) bool {
+	return p.Departed && len(p.Hand) > 0 && departurePolicy(r.Settings) != DepartureForfeit
+}
+
+// standIn returns the policy that moves for playerID now, or "" while the
+// game waits for them. Players of a correspondence game who let the turn
+// deadline pass get their lowest card played, whatever the room's policy.
+func standIn(r *model.Room, playerID string) string {
+	if departed(r, playerID) {
+		return departurePolicy(r.Settings)
+	}
+	if overdue(r) {
+		return DepartureLowest
+	}
+	return ""
+}
+
+// departedAction returns the move the room's departure policy makes next for
+// a departed or overdue player, or nil when the game is not waiting on one.
+func departedAction(r *model.Room, s engine.State) engine.Action {
+	switch s.Status {
+	case engine.StatusChoosingRow:
+		id := s.PendingPlay.PlayerID
+		switch standIn(r, id) {
+		case "":
+			return nil
+		case DepartureForfeit:
+			return engine.Forfeit{PlayerID: id}
+		case DepartureBot:
+			strategy, _ := bot.New(substituteStrategy, nil)
+			return engine.ChooseRow{PlayerID: id, Row: strategy.ChooseRow(bot.ViewOf(s, id), s.PendingPlay.Card)}
+		default:
+			return engine.ChooseRow{PlayerID: id, Row: bot.CheapestRow(s.Rows)}
+		}
+	case engine.StatusPlaying:
+		ids := make([]string, 0, len(s.Hands))
+		for id := range s.Hands {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			policy := standIn(r, id)
+			if _, selected := s.Selected[id]; selected || len(s.Hands[id]) == 0 || policy == "" {
+				continue
+			}
+			switch policy {
+			case DepartureForfeit:
+				return engine.Forfeit{PlayerID: id}
+			case DepartureBot:
+				strategy, _ := bot.New(substituteStrategy, nil)
+				return engine.PlayCard{PlayerID: id, Value: strategy.PlayCard(bot.ViewOf(s, id))}
+			default:
+				return engine.PlayCard{PlayerID: id, Value: s.Hands[id][0].Value}
+			}
+		}
+	}
+	return nil
+}
+
+// actForDeparted makes the next move for a departed player if the game is
+// waiting on one. apply calls it again after every move, so it runs until
+// the game waits on someone who is present or ends.
+// r 此时必须在外部被锁
+func (m *Manager) actForDeparted(r *model.Room) {
+	action := departedAction(r, engineState(r))
+	if action == nil {
+		return
+	}
+	roomLogger(r).Debug("acting for departed player", "policy", departurePolicy(r.Settings), "action", fmt.Sprintf("%T", action))
+	switch a := action.(type) {
+	case engine.PlayCard:
+		r.Players[a.PlayerID].BotAssisted = true
+	case engine.ChooseRow:
+		r.Players[a.PlayerID].BotAssisted = true
+	}
+	if err := m.apply(r, action); err != nil {
+		roomLogger(r).Error("departure policy move rejected", "error", err)
+	}
+}
+
+// HandleDeparture hands playerID's seat to the room's departure policy if
+// they hold cards in a game in progress. In a paused game the policy takes
+// over once the game resumes; leaving an adjourned or correspondence game is
+// expected and changes nothing.
+// r 此时必须在外部被锁
+func (m *Manager) HandleDeparture(r *model.Room, playerID string) {
+	p, ok := r.Players[playerID]
+	if !ok || p.IsOnline || p.Departed || len(p.Hand) == 0 || !gameRunning(r) || r.Status == StatusAdjourned || r.Settings.Correspondence {
+		return
+	}
+	m.handOver(r, p)
+}
+
+// handOver gives p's seat to the departure policy for the rest of the game.
+// r 此时必须在外部被锁
+func (m *Manager) handOver(r *model.Room, p *model.Player) {
+	p.Departed = true
+	BroadcastInfo(r, fmt.Sprintf("%s 在对局中离开，按房间设置%s", p.Name, departureNames[departurePolicy(r.Settings)]))
+	m.BroadcastState(r)
+	m.actForDeparted(r)
+}
+
+// HandleDisconnect starts the grace period of a player whose connection
+// dropped; if they have not logged in again by its end, their seat goes to
+// the departure policy.
+// r 此时必须在外部被锁
+func (m *Manager) HandleDisconnect(r *model.Room, playerID string) {
+	p, ok := r.Players[playerID]
+	if !ok {
+		return
+	}
+	p.OfflineSince = time.Now()
+	// Correspondence games are played offline; only the turn deadline moves for absent players.
+	if r.Settings.Correspondence {
+		return
+	}
+	if m.DepartureGrace <= 0 {
+		m.HandleDeparture(r, playerID)
+		return
+	}
+	time.AfterFunc(m.DepartureGrace, func() {
+		r.Mutex.Lock()
+		defer r.Mutex.Unlock()
+		if r.Deleted {
+			return
+		}
+		// A later disconnect has its own timer, and Resume restarts the ones a pause stopped.
+		if p, ok := r.Players[playerID]; ok && !p.IsOnline && r.Status != StatusPaused && time.Since(p.OfflineSince) >= m.DepartureGrace {
+			m.HandleDeparture(r, playerID)
+		}
+	})
+}
+
+// HandleReturn gives a departed player their seat back when they log in again.
+// r 此时必须在外部被锁
+func (m *Manager) HandleReturn(r *model.Room, playerID string) {
+	if p, ok := r.Players[playerID]; ok && p.Departed {
+		p.Departed = false
+		BroadcastInfo(r, fmt.Sprintf("%s 回来了，收回了自己的座位", p.Name))
+	}
+}
@@ -0,0 +1,419 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"take5/internal/engine"
+	"take5/internal/model"
+)
+
+// Duplicate mode.
+//
+// A duplicate match links several rooms ("tables") with the same number of
+// seats. Each board is dealt from one seed at every table, in seat order, so
+// seat k holds the same cards everywhere. Between boards the players of a
+// table move one seat along, and scores are compared seat by seat across
+// tables to produce a matchpoint scoreboard.
+//
+// Lock order: match.Mutex, then RoomsLock for lookups only, then the table
+// rooms' Mutex in table order. Code that already holds a room lock hands
+// cross-table work to a goroutine instead of taking these locks itself.
+
+const (
+	MaxDuplicateTables = 8
+	MaxDuplicateSeats  = engine.MaxPlayers
+)
+
+var (
+	ErrDuplicateSize    = fmt.Errorf("复式比赛需要 2-%d 桌，每桌 2-%d 人", MaxDuplicateTables, MaxDuplicateSeats)
+	ErrDuplicateNoRoom  = errors.New("房间不存在")
+	ErrDuplicateOwner   = errors.New("只有房主可以创建复式比赛")
+	ErrDuplicateState   = errors.New("只能在等待中的普通房间创建复式比赛")
+	ErrDuplicateRunning = errors.New("复式比赛还没有打完，不能解散比赛桌")
+	ErrDuplicateTableID = errors.New("复式比赛的桌号房间已被占用")
+)
+
+// CreateDuplicate turns a waiting room into table 1 of a new duplicate match
+// and creates the other tables as "<roomID>-2", "<roomID>-3", ... The match
+// plays one board per seat so every player plays every seat once.
+func (m *Manager) CreateDuplicate(roomID, requesterID string, tables, seats int) (*model.DuplicateMatch, error) {
+	if tables < 2 || tables > MaxDuplicateTables || seats < 2 || seats > MaxDuplicateSeats {
+		return nil, ErrDuplicateSize
+	}
+
+	m.RoomsLock.Lock()
+	base, ok := m.Rooms[roomID]
+	if !ok {
+		m.RoomsLock.Unlock()
+		return nil, ErrDuplicateNoRoom
+	}
+	ids := []string{roomID}
+	for i := 2; i <= tables; i++ {
+		id := fmt.Sprintf("%s-%d", roomID, i)
+		if _, exists := m.Rooms[id]; exists {
+			m.RoomsLock.Unlock()
+			return nil, ErrDuplicateTableID
+		}
+		ids = append(ids, id)
+	}
+
+	base.Mutex.Lock()
+	if base.OwnerID != requesterID {
+		base.Mutex.Unlock()
+		m.RoomsLock.Unlock()
+		return nil, ErrDuplicateOwner
+	}
+	if base.Status != "waiting" || base.DuplicateID != "" || base.TournamentID != "" {
+		base.Mutex.Unlock()
+		m.RoomsLock.Unlock()
+		return nil, ErrDuplicateState
+	}
+	match := &model.DuplicateMatch{
+		ID: roomID, OwnerID: requesterID, Tables: ids, Seats: seats, Boards: seats,
+		Lineups: make(map[string][]string), Names: make(map[string]string),
+	}
+	for i := 0; i < match.Boards; i++ {
+		match.Seeds = append(match.Seeds, NewSeed())
+	}
+	base.DuplicateID = match.ID
+	settings := base.Settings
+	base.Mutex.Unlock()
+
+	for _, id := range ids[1:] {
+		table := NewRoom(id, requesterID)
+		table.DuplicateID = match.ID
+		table.Settings = settings // 各桌条件相同
+		m.Rooms[id] = table
+		m.Store.PersistRoom(table)
+	}
+	m.RoomsLock.Unlock()
+
+	m.DuplicatesLock.Lock()
+	m.Duplicates[match.ID] = match
+	m.DuplicatesLock.Unlock()
+	m.Store.PersistDuplicate(match)
+
+	base.Mutex.Lock()
+	BroadcastInfo(base, fmt.Sprintf("复式比赛已创建：共 %d 桌（%s），每桌 %d 人，共 %d 副。各桌坐满并全部准备后同时开始。",
+		tables, strings.Join(ids, "、"), seats, match.Boards))
+	m.BroadcastState(base)
+	base.Mutex.Unlock()
+	return match, nil
+}
+
+// StartDuplicateBoardIfReady starts the next board at every table once each
+// table has its full lineup online and ready. It must not be called with a
+// room lock held.
+func (m *Manager) StartDuplicateBoardIfReady(id string) {
+	match := m.duplicate(id)
+	if match == nil {
+		return
+	}
+	match.Mutex.Lock()
+	defer match.Mutex.Unlock()
+
+	board := len(match.Results)
+	if board >= match.Boards {
+		return
+	}
+	rooms := m.tableRooms(match)
+	if rooms == nil {
+		return
+	}
+	lockTables(rooms)
+	defer unlockTables(rooms)
+
+	readyTables := 0
+	for _, r := range rooms {
+		if tableReady(match, r) {
+			readyTables++
+		}
+	}
+	if readyTables < len(rooms) {
+		for _, r := range rooms {
+			BroadcastInfo(r, fmt.Sprintf("复式第 %d 副：%d/%d 桌已就绪", board+1, readyTables, len(rooms)))
+		}
+		return
+	}
+
+	seed := match.Seeds[board]
+	match.Pending = make(map[string]model.DuplicateTable)
+	for _, r := range rooms {
+		lineup := match.Lineups[r.ID]
+		if lineup == nil {
+			// The first board fixes who plays at which table.
+			for pid, p := range r.Players {
+				if p.IsOnline {
+					lineup = append(lineup, pid)
+				}
+			}
+			sort.Strings(lineup)
+			match.Lineups[r.ID] = lineup
+		}
+		for _, pid := range lineup {
+			match.Names[pid] = r.Players[pid].Name
+		}
+		resetRound(r)
+		r.Board = board
+		r.SeatOrder = rotateSeats(lineup, board)
+		BroadcastInfo(r, fmt.Sprintf("复式第 %d/%d 副开始，各桌发的是同一副牌", board+1, match.Boards))
+		m.StartGameWithSeed(r, seed, nil)
+	}
+	m.Store.PersistDuplicate(match)
+	slog.Info("duplicate board started", "duplicate_id", match.ID, "board", board)
+}
+
+// finishDuplicateTable hands a finished table's seat scores to its match.
+// r 此时必须在外部被锁
+func (m *Manager) finishDuplicateTable(r *model.Room) {
+	result := model.DuplicateTable{
+		Seating: append([]string(nil), r.SeatOrder...),
+		Scores:  make([]int, len(r.SeatOrder)),
+	}
+	for k, pid := range r.SeatOrder {
+		if p := r.Players[pid]; p != nil {
+			result.Scores[k] = p.Score
+		}
+	}
+	BroadcastInfo(r, "本桌已完成本副牌，等待其他桌...")
+	go m.recordDuplicateTable(r.DuplicateID, r.ID, r.Board, result)
+}
+
+// recordDuplicateTable stores one table's result. When the last table of the
+// board reports in, the board is closed, its deal is revealed at every table
+// and the updated scoreboard is sent out.
+func (m *Manager) recordDuplicateTable(id, roomID string, board int, result model.DuplicateTable) {
+	match := m.duplicate(id)
+	if match == nil {
+		return
+	}
+	match.Mutex.Lock()
+	defer match.Mutex.Unlock()
+	if board != len(match.Results) || match.Pending == nil {
+		return
+	}
+	match.Pending[roomID] = result
+	done := len(match.Pending) == len(match.Tables)
+	if done {
+		match.Results = append(match.Results, model.DuplicateBoard{Seed: match.Seeds[board], Tables: match.Pending})
+		match.Pending = nil
+	}
+	m.Store.PersistDuplicate(match)
+
+	rooms := m.tableRooms(match)
+	if rooms == nil {
+		return
+	}
+	scoreboard := buildDuplicateScoreboard(match)
+	lockTables(rooms)
+	defer unlockTables(rooms)
+	for _, r := range rooms {
+		switch {
+		case !done:
+			BroadcastInfo(r, fmt.Sprintf("复式第 %d 副：%d/%d 桌已完成", board+1, len(match.Pending), len(match.Tables)))
+		case len(match.Results) == match.Boards:
+			BroadcastInfo(r, fmt.Sprintf("复式比赛结束！第一名：%s", scoreboard.Standings[0].Name))
+		default:
+			BroadcastInfo(r, fmt.Sprintf("复式第 %d 副全部完成，全员准备后开始下一副", board+1))
+		}
+		if done {
+			// The deal stays hidden until no table is still playing it.
+			lastDeal := r.Deal
+			r.LastDeal = &lastDeal
+			m.BroadcastState(r)
+		}
+		broadcastDuplicate(r, scoreboard)
+	}
+	if done {
+		slog.Info("duplicate board finished", "duplicate_id", match.ID, "board", board)
+	}
+}
+
+// DuplicateScoreboard returns the cross-table scoreboard of a match.
+func (m *Manager) DuplicateScoreboard(id string) (model.DuplicateScoreboard, bool) {
+	match := m.duplicate(id)
+	if match == nil {
+		return model.DuplicateScoreboard{}, false
+	}
+	match.Mutex.Lock()
+	defer match.Mutex.Unlock()
+	return buildDuplicateScoreboard(match), true
+}
+
+// buildDuplicateScoreboard compares every seat of every finished board with
+// the same seat at the other tables: fewer bulls scores 2 matchpoints, a tie
+// scores 1. match 此时必须在外部被锁
+func buildDuplicateScoreboard(match *model.DuplicateMatch) model.DuplicateScoreboard {
+	standings := make(map[string]*model.DuplicateStanding)
+	for table, lineup := range match.Lineups {
+		for _, pid := range lineup {
+			standings[pid] = &model.DuplicateStanding{PlayerID: pid, Name: match.Names[pid], Table: table}
+		}
+	}
+	for _, b := range match.Results {
+		for _, t1 := range match.Tables {
+			r1, ok := b.Tables[t1]
+			if !ok {
+				continue
+			}
+			for k, pid := range r1.Seating {
+				s, ok := standings[pid]
+				if !ok {
+					continue
+				}
+				s.Penalty += r1.Scores[k]
+				for _, t2 := range match.Tables {
+					r2, ok := b.Tables[t2]
+					if t2 == t1 || !ok || k >= len(r2.Scores) {
+						continue
+					}
+					if r1.Scores[k] < r2.Scores[k] {
+						s.MatchPoints += 2
+					} else if r1.Scores[k] == r2.Scores[k] {
+						s.MatchPoints++
+					}
+				}
+			}
+		}
+	}
+
+	list := make([]model.DuplicateStanding, 0, len(standings))
+	for _, s := range standings {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].MatchPoints != list[j].MatchPoints {
+			return list[i].MatchPoints > list[j].MatchPoints
+		}
+		if list[i].Penalty != list[j].Penalty {
+			return list[i].Penalty < list[j].Penalty
+		}
+		return list[i].Name < list[j].Name
+	})
+	names := make(map[string]string, len(match.Names))
+	for pid, name := range match.Names {
+		names[pid] = name
+	}
+	return model.DuplicateScoreboard{
+		ID: match.ID, Tables: match.Tables, Seats: match.Seats, Boards: match.Boards,
+		Played: len(match.Results), Results: append([]model.DuplicateBoard(nil), match.Results...),
+		Standings: list, Names: names,
+	}
+}
+
+// tableReady reports whether a table can start the next board: on the first
+// board exactly Seats online players who are all ready, afterwards its fixed
+// lineup online and ready. r 此时必须在外部被锁
+func tableReady(match *model.DuplicateMatch, r *model.Room) bool {
+	if r.Status != "waiting" && r.Status != "finished" {
+		return false
+	}
+	lineup := match.Lineups[r.ID]
+	if lineup == nil {
+		online := 0
+		for _, p := range r.Players {
+			if p.IsOnline {
+				if !p.Ready {
+					return false
+				}
+				online++
+			}
+		}
+		return online == match.Seats
+	}
+	for _, pid := range lineup {
+		if p := r.Players[pid]; p == nil || !p.IsOnline || !p.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// rotateSeats moves every player one seat along per board, so over Seats
+// boards each player holds each seat's cards once.
+func rotateSeats(lineup []string, board int) []string {
+	seats := make([]string, len(lineup))
+	for k := range seats {
+		seats[k] = lineup[(k+board)%len(lineup)]
+	}
+	return seats
+}
+
+func broadcastDuplicate(r *model.Room, scoreboard model.DuplicateScoreboard) {
+	msg := model.Message{Type: "duplicate_scoreboard", Payload: scoreboard}
+	for _, p := range r.Players {
+		if p.Conn != nil && !guest(p) {
+			send(r, p.ID, p.Conn, msg)
+		}
+	}
+	for _, sp := range r.Spectators {
+		send(r, sp.ID, sp.Conn, msg)
+	}
+}
+
+// DuplicateInProgress reports whether the duplicate match id still has boards
+// to play. Its tables are not deleted until it is over, since the match
+// waits for every table's result. No room lock may be held.
+func (m *Manager) DuplicateInProgress(id string) bool {
+	match := m.duplicate(id)
+	if match == nil {
+		return false
+	}
+	match.Mutex.Lock()
+	defer match.Mutex.Unlock()
+	return len(match.Results) < match.Boards
+}
+
+// activeDuplicates returns the IDs of the duplicate matches still in
+// progress. No room lock may be held.
+func (m *Manager) activeDuplicates() map[string]bool {
+	m.DuplicatesLock.Lock()
+	ids := make([]string, 0, len(m.Duplicates))
+	for id := range m.Duplicates {
+		ids = append(ids, id)
+	}
+	m.DuplicatesLock.Unlock()
+	active := make(map[string]bool)
+	for _, id := range ids {
+		if m.DuplicateInProgress(id) {
+			active[id] = true
+		}
+	}
+	return active
+}
+
+func (m *Manager) duplicate(id string) *model.DuplicateMatch {
+	m.DuplicatesLock.Lock()
+	defer m.DuplicatesLock.Unlock()
+	return m.Duplicates[id]
+}
+
+// tableRooms looks up the rooms of a match, or nil if a table is gone.
+func (m *Manager) tableRooms(match *model.DuplicateMatch) []*model.Room {
+	m.RoomsLock.Lock()
+	defer m.RoomsLock.Unlock()
+	rooms := make([]*model.Room, 0, len(match.Tables))
+	for _, id := range match.Tables {
+		r, ok := m.Rooms[id]
+		if !ok {
+			return nil
+		}
+		rooms = append(rooms, r)
+	}
+	return rooms
+}
+
+func lockTables(rooms []*model.Room) {
+	for _, r := range rooms {
+		r.Mutex.Lock()
+	}
+}
+
+func unlockTables(rooms []*model.Room) {
+	for _, r := range rooms {
+		r.Mutex.Unlock()
+	}
+}
@@ -0,0 +1,101 @@
+package game
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"take5/internal/engine"
+	"take5/internal/model"
+)
+
+// Provably fair dealing.
+//
+// Before a game the room publishes SeedCommit(seed) for the upcoming server
+// seed, and players may contribute client seeds. At the start the deck is
+// shuffled with an engine.DealRNG keyed by engine.ShuffleKey(seed, clientSeeds) and
+// DeckCommit is published. When the game ends the whole DealRecord is
+// revealed so anyone can recompute the shuffle. The algorithm is kept simple
+// enough to be reimplemented in the browser (see static/js/fair.js).
+
+// MaxClientSeedLength bounds the client seed a player may contribute.
+const MaxClientSeedLength = 64
+
+var (
+	ErrSeedCommitMismatch = errors.New("seed does not match its commitment")
+	ErrDeckMismatch       = errors.New("deck does not match the seeds")
+	ErrDeckCommitMismatch = errors.New("deck does not match its commitment")
+)
+
+// SeedCommit is the hex sha256 of the decimal server seed.
+func SeedCommit(seed int64) string {
+	sum := sha256.Sum256([]byte(strconv.FormatInt(seed, 10)))
+	return hex.EncodeToString(sum[:])
+}
+
+// DeckCommit is the hex sha256 of "<seed>:<v1,v2,...>".
+func DeckCommit(seed int64, deck []int) string {
+	parts := make([]string, len(deck))
+	for i, v := range deck {
+		parts[i] = strconv.Itoa(v)
+	}
+	sum := sha256.Sum256([]byte(strconv.FormatInt(seed, 10) + ":" + strings.Join(parts, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+// ShuffledDeck recomputes the deck order produced by a seed and client seeds.
+func ShuffledDeck(seed int64, clientSeeds map[string]string) []int {
+	r := &model.Room{}
+	InitDeck(r, engine.NewDealRNG(engine.ShuffleKey(seed, clientSeeds)))
+	return deckValues(r.Deck)
+}
+
+// VerifyDeal checks a revealed deal against its commitments.
+func VerifyDeal(d model.DealRecord) error {
+	if SeedCommit(d.Seed) != d.SeedCommit {
+		return ErrSeedCommitMismatch
+	}
+	if !slices.Equal(ShuffledDeck(d.Seed, d.ClientSeeds), d.Deck) {
+		return ErrDeckMismatch
+	}
+	if DeckCommit(d.Seed, d.Deck) != d.DeckCommit {
+		return ErrDeckCommitMismatch
+	}
+	return nil
+}
+
+// SetClientSeed records a player's contribution to the next deal.
+func (m *Manager) SetClientSeed(r *model.Room, playerID, clientSeed string) error {
+	if _, ok := r.Players[playerID]; !ok {
+		return ErrNotInRoom
+	}
+	if clientSeed == "" || len(clientSeed) > MaxClientSeedLength {
+		return fmt.Errorf("客户端种子长度须为 1-%d", MaxClientSeedLength)
+	}
+	if r.ClientSeeds == nil {
+		r.ClientSeeds = make(map[string]string)
+	}
+	r.ClientSeeds[playerID] = clientSeed
+	return nil
+}
+
+// upcomingSeed returns the server seed for the next deal, drawing one the
+// first time it is needed.
+func upcomingSeed(r *model.Room) int64 {
+	if r.UpcomingSeed == 0 {
+		r.UpcomingSeed = NewSeed()
+		r.SeedFixed = false
+	}
+	return r.UpcomingSeed
+}
+
+func deckValues(deck []model.Card) []int {
+	values := make([]int, len(deck))
+	for i, c := range deck {
+		values[i] = c.Value
+	}
+	return values
+}
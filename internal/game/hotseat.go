@@ -0,0 +1,153 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"take5/internal/model"
+
+	"github.com/gorilla/websocket"
+)
+
+// Hot-seat play lets one connection hold several seats, as when a table
+// shares a single tablet. The player who logged in on the connection is the
+// host; the extra seats are its guests and share the host's connection.
+// Every seat gets its own state message, but only the seat the device is
+// currently handed to sees its hand.
+
+var (
+	ErrSeatHost    = errors.New("只有用自己的设备入座的玩家可以添加同屏座位")
+	ErrSeatTaken   = errors.New("该玩家已经在房间中入座")
+	ErrSeatKicked  = errors.New("该玩家已被投票移出该房间")
+	ErrNotYourSeat = errors.New("这个座位不在你的设备上")
+)
+
+// guest reports whether p is played from another player's connection.
+// Room-wide messages reach it through its host's connection.
+func guest(p *model.Player) bool {
+	return p.Host != ""
+}
+
+// hostOf returns the player whose connection p is played from.
+func hostOf(p *model.Player) string {
+	if guest(p) {
+		return p.Host
+	}
+	return p.ID
+}
+
+// seatsOf returns the seats played from hostID's connection: the host's own
+// first, then its connected guests.
+func seatsOf(r *model.Room, hostID string) []string {
+	guests := []string{}
+	for id, p := range r.Players {
+		if p.Host == hostID && p.Conn != nil {
+			guests = append(guests, id)
+		}
+	}
+	sort.Strings(guests)
+	return append([]string{hostID}, guests...)
+}
+
+// activeSeat returns the seat hostID's device is currently handed to.
+func activeSeat(r *model.Room, hostID string) string {
+	if host, ok := r.Players[hostID]; ok && host.ActiveSeat != "" && slices.Contains(seatsOf(r, hostID), host.ActiveSeat) {
+		return host.ActiveSeat
+	}
+	return hostID
+}
+
+// SeatsOn returns the seats that are played from conn.
+// r 此时必须在外部被锁
+func SeatsOn(r *model.Room, conn *websocket.Conn) []string {
+	ids := []string{}
+	for id, p := range r.Players {
+		if p.Conn == conn {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SeatFor returns the seat an action from hostID's connection is for:
+// seatID if given, the seat the device is handed to otherwise.
+// r 此时必须在外部被锁
+func SeatFor(r *model.Room, hostID, seatID string) (string, error) {
+	if seatID == "" {
+		return activeSeat(r, hostID), nil
+	}
+	if !slices.Contains(seatsOf(r, hostID), seatID) {
+		return "", ErrNotYourSeat
+	}
+	return seatID, nil
+}
+
+// HandSeatFor is SeatFor for actions that play from or look at a hand. They
+// are only taken for the seat the device is handed to, so the hands of the
+// other seats stay hidden until their turn with the device.
+// r 此时必须在外部被锁
+func HandSeatFor(r *model.Room, hostID, seatID string) (string, error) {
+	active := activeSeat(r, hostID)
+	if seatID != "" && seatID != active {
+		return "", ErrNotYourSeat
+	}
+	return active, nil
+}
+
+// AddSeat seats the player seatID at hostID's connection. A player who is
+// already in the room may be taken over as long as they have no connection
+// of their own.
+// r 此时必须在外部被锁
+func (m *Manager) AddSeat(r *model.Room, hostID, seatID, name string) error {
+	host, ok := r.Players[hostID]
+	if !ok || host.Conn == nil || guest(host) {
+		return ErrSeatHost
+	}
+	if slices.Contains(r.Kicked, seatID) {
+		return ErrSeatKicked
+	}
+	if p, ok := r.Players[seatID]; ok {
+		// A player on their own device, or hosting seats themselves, keeps their connection.
+		if seatID == hostID || (p.Conn != nil && p.Host != hostID) || len(seatsOf(r, seatID)) > 1 {
+			return ErrSeatTaken
+		}
+		p.Name, p.Host, p.Conn, p.IsOnline = name, hostID, host.Conn, true
+		m.HandleReturn(r, seatID)
+	} else {
+		r.Players[seatID] = &model.Player{ID: seatID, Name: name, Conn: host.Conn, IsOnline: true, Host: hostID}
+	}
+	BroadcastInfo(r, fmt.Sprintf("%s 在 %s 的设备上入座", name, host.Name))
+	QueueLateJoiner(r, seatID)
+	m.ResumeAdjourned(r)
+	m.BroadcastState(r)
+	return nil
+}
+
+// SwitchSeat hands hostID's device to seatID, whose hand it shows from now on.
+// r 此时必须在外部被锁
+func (m *Manager) SwitchSeat(r *model.Room, hostID, seatID string) error {
+	if !slices.Contains(seatsOf(r, hostID), seatID) {
+		return ErrNotYourSeat
+	}
+	r.Players[hostID].ActiveSeat = seatID
+	m.BroadcastState(r)
+	return nil
+}
+
+// ReattachSeats brings the guests of a host who logged in again back onto
+// the host's new connection.
+// r 此时必须在外部被锁
+func (m *Manager) ReattachSeats(r *model.Room, hostID string) {
+	host, ok := r.Players[hostID]
+	if !ok {
+		return
+	}
+	for id, p := range r.Players {
+		if p.Host == hostID && p.Conn == nil {
+			p.Conn, p.IsOnline = host.Conn, true
+			m.HandleReturn(r, id)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package game
+
+import (
+	"log/slog"
+	"take5/internal/model"
+	"time"
+)
+
+// JanitorConfig controls how rooms that nobody uses any more are cleaned up.
+type JanitorConfig struct {
+	TTL        time.Duration // 房间无人在线且空闲超过该时长后被清理，<= 0 表示不清理
+	WarnBefore time.Duration // 清理前多久在大厅中标记“即将清理”
+	Interval   time.Duration // 扫描间隔
+	Archive    bool          // true 时归档到 archived_rooms，否则直接删除
+}
+
+// DefaultJanitorConfig returns the settings used when none are supplied.
+func DefaultJanitorConfig() JanitorConfig {
+	return JanitorConfig{
+		TTL:        7 * 24 * time.Hour,
+		WarnBefore: 24 * time.Hour,
+		Interval:   10 * time.Minute,
+		Archive:    true,
+	}
+}
+
+// StartJanitor launches the background sweeper for stale rooms.
+func (m *Manager) StartJanitor(cfg JanitorConfig) {
+	m.Janitor = cfg
+	if cfg.TTL <= 0 || cfg.Interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			m.SweepStaleRooms(now)
+		}
+	}()
+}
+
+// SweepStaleRooms warns about and then archives or deletes rooms that have
+// had no connected players and no activity for longer than the TTL.
+func (m *Manager) SweepStaleRooms(now time.Time) {
+	cfg := m.Janitor
+	if cfg.TTL <= 0 {
+		return
+	}
+
+	changed := false
+	duplicates := m.activeDuplicates()
+	m.RoomsLock.Lock()
+	for id, r := range m.Rooms {
+		r.Mutex.Lock()
+		// Adjourned games wait for their players however long it takes, and
+		// a duplicate match for the result of every table.
+		if hasConnectedPlayer(r) || r.Status == StatusAdjourned || duplicates[r.DuplicateID] {
+			r.Mutex.Unlock()
+			continue
+		}
+
+		idle := now.Sub(r.LastActive)
+		if idle >= cfg.TTL {
+			var err error
+			if cfg.Archive {
+				err = m.Store.ArchiveRoom(r)
+			} else {
+				m.Store.DeleteRoom(r.ID)
+			}
+			if err != nil {
+				slog.Error("failed to archive stale room", "room_id", id, "err", err)
+				r.Mutex.Unlock()
+				continue
+			}
+			r.Deleted = true
+			delete(m.Rooms, id)
+			slog.Info("removed stale room", "room_id", id, "idle", idle.Round(time.Minute).String(), "archived", cfg.Archive)
+			changed = true
+		} else if idle >= cfg.TTL-cfg.WarnBefore && !r.StaleWarned {
+			// Nobody is connected, so the warning is surfaced in the lobby listing.
+			r.StaleWarned = true
+			m.Store.PersistRoom(r)
+			slog.Info("stale room scheduled for removal", "room_id", id, "expires_at", r.LastActive.Add(cfg.TTL))
+			changed = true
+		}
+		r.Mutex.Unlock()
+	}
+	m.RoomsLock.Unlock()
+
+	if changed {
+		go m.BroadcastRoomList()
+	}
+}
+
+// Touch records activity in the room so the janitor leaves it alone.
+func Touch(r *model.Room) {
+	r.LastActive = time.Now()
+	r.StaleWarned = false
+}
+
+// hasConnectedPlayer reports whether anybody currently holds a connection to
+// the room. IsOnline is not used because it survives a server restart.
+func hasConnectedPlayer(r *model.Room) bool {
+	for _, p := range r.Players {
+		if p.Conn != nil {
+			return true
+		}
+	}
+	return len(r.Spectators) > 0
+}
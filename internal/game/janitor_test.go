@@ -0,0 +1,37 @@
+package game
+
+import (
+	"path/filepath"
+	"take5/internal/database"
+	"take5/internal/model"
+	"testing"
+	"time"
+)
+
+func TestSweepKeepsDuplicateTables(t *testing.T) {
+	store, err := database.NewStore(filepath.Join(t.TempDir(), "take5.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m := NewManager(store)
+	m.Janitor = JanitorConfig{TTL: time.Hour}
+	r := NewRoom("dup-2", "alice")
+	r.DuplicateID = "dup"
+	r.LastActive = time.Now().Add(-2 * time.Hour)
+	if err := m.AddRoom(r); err != nil {
+		t.Fatal(err)
+	}
+	match := &model.DuplicateMatch{ID: "dup", Tables: []string{"dup", "dup-2"}, Boards: 2}
+	m.Duplicates[match.ID] = match
+
+	m.SweepStaleRooms(time.Now())
+	if m.Rooms[r.ID] == nil {
+		t.Fatal("swept a table of a match still in progress")
+	}
+	match.Results = make([]model.DuplicateBoard, match.Boards)
+	m.SweepStaleRooms(time.Now())
+	if m.Rooms[r.ID] != nil {
+		t.Error("kept an idle table of a finished match")
+	}
+}
@@ -0,0 +1,188 @@
+package game
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"take5/internal/metrics"
+	"take5/internal/model"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// LobbyChatRoomID is the chat_messages room_id under which lobby chat is
+// stored. Room IDs starting with "#" are reserved, so no room shares it.
+const LobbyChatRoomID = "#lobby"
+
+var (
+	ErrInviteOffline = errors.New("对方已不在大厅")
+	ErrInviteRoom    = errors.New("房间不存在")
+	ErrInviteSelf    = errors.New("不能邀请自己")
+)
+
+// JoinLobby registers a lobby connection and sends it the lobby chat history
+// and the tournament list.
+func (m *Manager) JoinLobby(conn *websocket.Conn) {
+	history := m.Store.GetChatHistory(LobbyChatRoomID, ChatHistorySize)
+	tournaments := m.TournamentList()
+	m.LobbyLock.Lock()
+	m.LobbyConns[conn] = &model.LobbyUser{}
+	writeLobby(conn, model.Message{Type: "lobby_chat_history", Payload: history})
+	writeLobby(conn, model.Message{Type: "tournaments", Payload: tournaments})
+	m.LobbyLock.Unlock()
+	go m.BroadcastRoomList()
+}
+
+// LeaveLobby forgets a lobby connection.
+func (m *Manager) LeaveLobby(conn *websocket.Conn) {
+	m.LobbyLock.Lock()
+	delete(m.LobbyConns, conn)
+	m.pruneLobbyChats(time.Now())
+	m.LobbyLock.Unlock()
+	go m.BroadcastRoomList()
+}
+
+// IdentifyLobbyUser attaches a user identity to a lobby connection so it
+// shows up in the presence list and may chat and send invitations, and
+// sends it the adjourned games the user takes part in.
+func (m *Manager) IdentifyLobbyUser(conn *websocket.Conn, id, name string) {
+	games := m.Store.SavedGames()
+	m.LobbyLock.Lock()
+	if u, ok := m.LobbyConns[conn]; ok {
+		u.ID = id
+		u.Name = name
+		writeLobby(conn, model.Message{Type: "identity", Payload: map[string]string{"id": id, "name": name}})
+		sendSavedGames(conn, id, games)
+	}
+	m.LobbyLock.Unlock()
+	go m.BroadcastRoomList()
+}
+
+// HandleLobbyChat validates, stores and broadcasts a lobby chat line.
+func (m *Manager) HandleLobbyChat(conn *websocket.Conn, text string) error {
+	m.LobbyLock.Lock()
+	defer m.LobbyLock.Unlock()
+
+	u := m.LobbyConns[conn]
+	if u == nil || u.ID == "" {
+		return ErrNotIdentified
+	}
+	text, err := m.checkChatText(u.ID, text)
+	if err != nil {
+		return err
+	}
+	// The limit follows the user, not the connection: more lobby tabs do
+	// not buy more messages.
+	now := time.Now()
+	history := m.LobbyChats[u.ID]
+	allowed := allowChat(&history, now)
+	m.LobbyChats[u.ID] = history
+	if !allowed {
+		return ErrChatRateLimited
+	}
+
+	msg := model.ChatMessage{PlayerID: u.ID, Name: u.Name, Kind: "chat", Text: text, SentAt: now.UnixMilli()}
+	m.Store.SaveChatMessage(LobbyChatRoomID, msg)
+	out := model.Message{Type: "lobby_chat", Payload: msg}
+	for c := range m.LobbyConns {
+		writeLobby(c, out)
+	}
+	return nil
+}
+
+// pruneLobbyChats forgets the lobby chat history of users who have not
+// chatted within the rate-limit window; it no longer limits them. Keeping
+// users who are still inside it stops a reconnect from resetting the limit.
+// LobbyLock must be held.
+func (m *Manager) pruneLobbyChats(now time.Time) {
+	for id, history := range m.LobbyChats {
+		if len(history) == 0 || now.Sub(history[len(history)-1]) >= chatRateInterval {
+			delete(m.LobbyChats, id)
+		}
+	}
+}
+
+// SendInvite forwards a room invitation from the user on conn to every lobby
+// connection of the target user.
+func (m *Manager) SendInvite(conn *websocket.Conn, targetID, roomID string) error {
+	m.RoomsLock.Lock()
+	_, exists := m.Rooms[roomID]
+	m.RoomsLock.Unlock()
+	if !exists {
+		return ErrInviteRoom
+	}
+
+	m.LobbyLock.Lock()
+	defer m.LobbyLock.Unlock()
+
+	from := m.LobbyConns[conn]
+	if from == nil || from.ID == "" {
+		return ErrNotIdentified
+	}
+	if from.ID == targetID {
+		return ErrInviteSelf
+	}
+	out := model.Message{Type: "invite", Payload: model.Invite{FromID: from.ID, FromName: from.Name, RoomID: roomID}}
+	delivered := false
+	for c, u := range m.LobbyConns {
+		if u.ID == targetID {
+			writeLobby(c, out)
+			delivered = true
+		}
+	}
+	if !delivered {
+		return ErrInviteOffline
+	}
+	slog.Info("invite sent", "player_id", from.ID, "target_id", targetID, "room_id", roomID)
+	return nil
+}
+
+// lobbyIdentity returns who is behind a lobby connection, or empty strings
+// before the client has said hello.
+func (m *Manager) lobbyIdentity(conn *websocket.Conn) (id, name string) {
+	m.LobbyLock.Lock()
+	defer m.LobbyLock.Unlock()
+	if u := m.LobbyConns[conn]; u != nil {
+		return u.ID, u.Name
+	}
+	return "", ""
+}
+
+// SendLobbyInfo sends a text notice to a single lobby connection.
+func (m *Manager) SendLobbyInfo(conn *websocket.Conn, text string) {
+	m.LobbyLock.Lock()
+	writeLobby(conn, model.Message{Type: "info", Payload: text})
+	m.LobbyLock.Unlock()
+}
+
+// buildPresence merges the users seen in rooms with the identified lobby
+// users. LobbyLock must be held.
+func (m *Manager) buildPresence(inRoom map[string]model.PresenceEntry) []model.PresenceEntry {
+	seen := make(map[string]model.PresenceEntry, len(inRoom))
+	for id, e := range inRoom {
+		seen[id] = e
+	}
+	for _, u := range m.LobbyConns {
+		if u.ID == "" {
+			continue
+		}
+		if _, ok := seen[u.ID]; !ok {
+			seen[u.ID] = model.PresenceEntry{ID: u.ID, Name: u.Name}
+		}
+	}
+	list := make([]model.PresenceEntry, 0, len(seen))
+	for _, e := range seen {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// writeLobby writes to a lobby connection. LobbyLock must be held.
+func writeLobby(conn *websocket.Conn, msg model.Message) {
+	if err := WriteJSON(conn, msg); err != nil {
+		metrics.Errors.WithLabelValues(metrics.SourceWebSocketWrite).Inc()
+		slog.Warn("failed to write to lobby", "remote_addr", conn.RemoteAddr().String(), "msg_type", msg.Type, "err", err)
+	}
+}
@@ -0,0 +1,19 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPruneLobbyChats(t *testing.T) {
+	now := time.Now()
+	m := &Manager{LobbyChats: map[string][]time.Time{
+		"quiet":  {now.Add(-2 * chatRateInterval), now.Add(-chatRateInterval)},
+		"recent": {now.Add(-2 * chatRateInterval), now.Add(-time.Second)},
+		"empty":  {},
+	}}
+	m.pruneLobbyChats(now)
+	if len(m.LobbyChats) != 1 || m.LobbyChats["recent"] == nil {
+		t.Errorf("kept %v, want only the user who chatted within the window", m.LobbyChats)
+	}
+}
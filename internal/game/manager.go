@@ -1,10 +1,13 @@
 package game
 
 import (
-	"fmt"
+	"errors"
+	"log/slog"
+	"strings"
 	"sync"
 	"take5/internal/database"
 	"take5/internal/model"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -12,27 +15,134 @@ import (
 type Manager struct {
 	Rooms      map[string]*model.Room
 	RoomsLock  sync.Mutex
-	LobbyConns map[*websocket.Conn]bool
+	LobbyConns map[*websocket.Conn]*model.LobbyUser
 	LobbyLock  sync.Mutex
+	LobbyChats map[string][]time.Time // 每个用户最近的大厅发言时间，受 LobbyLock 保护，大厅连接断开时清理已过限流窗口的用户
 	Store      *database.Store
+	Janitor    JanitorConfig
+	// DepartureGrace is how long a player who lost their connection mid-game
+	// is waited for before the departure policy takes over their seat.
+	DepartureGrace time.Duration
+	// VoteTimeout is how long a vote stays open before it fails.
+	VoteTimeout time.Duration
+	// TurnDeadline is how long a correspondence game waits for each move.
+	TurnDeadline time.Duration
+	// RematchWindow is how long players have to answer a rematch offer.
+	// Correspondence rooms give them a turn deadline instead.
+	RematchWindow time.Duration
+	// NoShowWindow is how long the entrants of a tournament table have to
+	// turn up before the game starts without them.
+	NoShowWindow time.Duration
+	Moderators   []ChatModerator // 按顺序作用于房间聊天和大厅聊天
+
+	Duplicates     map[string]*model.DuplicateMatch
+	DuplicatesLock sync.Mutex // 只保护 Duplicates 映射本身，不与其他锁嵌套
+
+	Tournaments     map[string]*model.Tournament
+	TournamentsLock sync.Mutex // 只保护 Tournaments 映射本身，不与其他锁嵌套
 }
 
+var (
+	ErrRoomExists   = errors.New("房间号已存在")
+	ErrRoomReserved = errors.New("房间号不能以 # 开头")
+)
+
 func NewManager(store *database.Store) *Manager {
 	return &Manager{
 		Rooms:      make(map[string]*model.Room),
-		LobbyConns: make(map[*websocket.Conn]bool),
+		LobbyConns: make(map[*websocket.Conn]*model.LobbyUser),
+		LobbyChats: make(map[string][]time.Time),
 		Store:      store,
+		Duplicates: make(map[string]*model.DuplicateMatch),
+
+		Tournaments: make(map[string]*model.Tournament),
+
+		DepartureGrace: DefaultDepartureGrace,
+		VoteTimeout:    DefaultVoteTimeout,
+		TurnDeadline:   DefaultTurnDeadline,
+		RematchWindow:  DefaultRematchWindow,
+		NoShowWindow:   DefaultNoShowWindow,
 	}
 }
 
 func (m *Manager) LoadRooms() {
 	rooms, err := m.Store.LoadRooms()
 	if err != nil {
-		fmt.Println("Error loading rooms:", err)
+		slog.Error("failed to load rooms", "err", err)
 		return
 	}
+	// Rooms saved before activity tracking existed start their idle clock now.
+	for _, r := range rooms {
+		if r.LastActive.IsZero() {
+			r.LastActive = time.Now()
+		}
+		// Adjourned games are never cleaned up, so they carry no warning either.
+		if r.Status == StatusAdjourned {
+			r.StaleWarned = false
+		}
+	}
 	m.RoomsLock.Lock()
 	m.Rooms = rooms
 	m.RoomsLock.Unlock()
-	fmt.Printf("Loaded %d rooms from database\n", len(rooms))
+	slog.Info("loaded rooms from database", "count", len(rooms))
+	// Turn deadlines, rematch offers and no-show deadlines that ran out while
+	// the server was down close right away.
+	for _, r := range rooms {
+		if r.Settings.Correspondence && !r.TurnDeadline.IsZero() {
+			m.scheduleTurnDeadline(r)
+		}
+		if r.Rematch != nil {
+			m.scheduleRematch(r)
+		}
+		if !r.NoShowAt.IsZero() {
+			m.scheduleNoShow(r)
+		}
+	}
+
+	matches, err := m.Store.LoadDuplicates()
+	if err != nil {
+		slog.Error("failed to load duplicate matches", "err", err)
+	} else {
+		m.DuplicatesLock.Lock()
+		m.Duplicates = matches
+		m.DuplicatesLock.Unlock()
+	}
+
+	tournaments, err := m.Store.LoadTournaments()
+	if err != nil {
+		slog.Error("failed to load tournaments", "err", err)
+	} else {
+		m.TournamentsLock.Lock()
+		m.Tournaments = tournaments
+		m.TournamentsLock.Unlock()
+	}
+	m.BroadcastRoomList() // Also seeds the room gauges for /metrics
+}
+
+// NewRoom builds an empty waiting room owned by ownerID.
+func NewRoom(id, ownerID string) *model.Room {
+	r := &model.Room{
+		ID: id, OwnerID: ownerID, Players: make(map[string]*model.Player), Status: "waiting",
+		LastActive: time.Now(),
+	}
+	for i := 0; i < 4; i++ {
+		r.Rows[i].Cards = make([]model.Card, 0)
+	}
+	return r
+}
+
+// AddRoom registers and persists a new room unless its ID is taken or
+// reserved.
+func (m *Manager) AddRoom(r *model.Room) error {
+	if strings.HasPrefix(r.ID, "#") {
+		return ErrRoomReserved
+	}
+	m.RoomsLock.Lock()
+	defer m.RoomsLock.Unlock()
+	if _, exists := m.Rooms[r.ID]; exists {
+		return ErrRoomExists
+	}
+	m.Rooms[r.ID] = r
+	m.Store.PersistRoom(r)
+	return nil
 }
@@ -0,0 +1,46 @@
+package game
+
+import (
+	"path/filepath"
+	"take5/internal/database"
+	"take5/internal/model"
+	"testing"
+	"time"
+)
+
+// A timer that fires while the room is being deleted waits for the room lock
+// and must then leave the deleted room alone rather than save it again.
+func TestTimerSkipsDeletedRoom(t *testing.T) {
+	store, err := database.NewStore(filepath.Join(t.TempDir(), "take5.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m := NewManager(store)
+	r := NewRoom("gone", "alice")
+	if err := m.AddRoom(r); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Mutex.Lock()
+	rm := &model.Rematch{Players: []string{"alice", "bob"}, Deadline: time.Now()}
+	r.Rematch = rm
+	m.scheduleRematch(r)
+	time.Sleep(50 * time.Millisecond) // the timer is now waiting for the lock
+	r.Deleted = true
+	r.Mutex.Unlock()
+	m.RoomsLock.Lock()
+	delete(m.Rooms, r.ID)
+	m.RoomsLock.Unlock()
+	store.DeleteRoom(r.ID)
+
+	time.Sleep(50 * time.Millisecond)
+	r.Mutex.Lock()
+	defer r.Mutex.Unlock()
+	if r.Rematch != rm {
+		t.Error("the rematch timer acted on a deleted room")
+	}
+	if rooms, err := store.LoadRooms(); err != nil || len(rooms) != 0 {
+		t.Errorf("stored rooms %v (%v), want none", rooms, err)
+	}
+}
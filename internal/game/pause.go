@@ -0,0 +1,76 @@
+package game
+
+import (
+	"errors"
+	"take5/internal/model"
+)
+
+// StatusPaused is the status of a room whose game is frozen. The status it
+// was paused from is kept in Room.PausedStatus.
+const StatusPaused = "paused"
+
+var (
+	ErrNotPausable = errors.New("只有进行中的对局可以暂停")
+	ErrNotPaused   = errors.New("对局没有暂停")
+	ErrPauseOwner  = errors.New("只有房主可以直接暂停或继续，其他玩家可以发起投票")
+)
+
+// gameRunning reports whether r has a game that is not over yet, paused,
+// adjourned or not.
+func gameRunning(r *model.Room) bool {
+	return inProgress(r) || r.Status == StatusPaused || r.Status == StatusAdjourned
+}
+
+// Pause freezes the game in progress: the engine refuses plays and row
+// choices while the room is paused, and departure grace periods stop
+// running. The paused status is persisted like any other, so a paused game
+// survives a server restart.
+// r 此时必须在外部被锁
+func (m *Manager) Pause(r *model.Room) error {
+	if !inProgress(r) {
+		return ErrNotPausable
+	}
+	r.PausedStatus, r.Status = r.Status, StatusPaused
+	BroadcastInfo(r, "对局已暂停")
+	m.BroadcastState(r)
+	return nil
+}
+
+// Resume puts a paused game back in the status it was paused from. Players
+// still offline get a fresh grace period before the departure policy takes
+// over their seat, and a correspondence game a fresh turn deadline.
+// r 此时必须在外部被锁
+func (m *Manager) Resume(r *model.Room) error {
+	if r.Status != StatusPaused {
+		return ErrNotPaused
+	}
+	r.Status, r.PausedStatus = r.PausedStatus, ""
+	m.startTurnClock(r)
+	BroadcastInfo(r, "对局继续")
+	m.BroadcastState(r)
+	for _, id := range r.Deal.DealOrder {
+		if p, ok := r.Players[id]; ok && !p.IsOnline && !p.Departed && len(p.Hand) > 0 {
+			m.HandleDisconnect(r, id)
+		}
+	}
+	m.actForDeparted(r)
+	return nil
+}
+
+// OwnerPause pauses the game at the owner's request.
+// r 此时必须在外部被锁
+func (m *Manager) OwnerPause(r *model.Room, requesterID string) error {
+	if r.OwnerID != requesterID {
+		return ErrPauseOwner
+	}
+	return m.Pause(r)
+}
+
+// OwnerResume resumes the game at the owner's request.
+// r 此时必须在外部被锁
+func (m *Manager) OwnerResume(r *model.Room, requesterID string) error {
+	if r.OwnerID != requesterID {
+		return ErrPauseOwner
+	}
+	return m.Resume(r)
+}
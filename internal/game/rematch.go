@@ -0,0 +1,274 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"take5/internal/model"
+	"time"
+)
+
+// After a game in an ordinary room the players who took part are offered a
+// rematch. The next game starts as soon as everyone has answered or the
+// window runs out, with the seats rotated by one so that a fixed seed does
+// not keep dealing the same hand to the same player. Games linked this way
+// form a series whose totals are kept on the room.
+
+// DefaultRematchWindow is Manager.RematchWindow unless configured.
+const DefaultRematchWindow = 30 * time.Second
+
+var (
+	ErrNoRematch       = errors.New("现在没有再来一局的邀请")
+	ErrNotInRematch    = errors.New("你没有参加上一局，不需要回应")
+	ErrRematchAnswered = errors.New("你已经回应过了")
+)
+
+// rematchWindow returns how long the players of r have to answer a rematch.
+func (m *Manager) rematchWindow(r *model.Room) time.Duration {
+	if r.Settings.Correspondence {
+		return m.TurnDeadline
+	}
+	return m.RematchWindow
+}
+
+// rematchPlayers returns the players a rematch is offered to: those dealt
+// into the game that just finished who are still around to answer.
+// Correspondence players are asked whether they are online or not.
+func rematchPlayers(r *model.Room) []string {
+	ids := []string{}
+	for _, id := range r.Deal.DealOrder {
+		if p, ok := r.Players[id]; ok && !p.Departed && (p.IsOnline || r.Settings.Correspondence) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// offerRematch asks the players of the game that just finished whether they
+// want to play again.
+// r 此时必须在外部被锁
+func (m *Manager) offerRematch(r *model.Room) {
+	ids := rematchPlayers(r)
+	if len(ids) < 2 {
+		BroadcastInfo(r, "在线人数不足，无法再来一局。")
+		m.BroadcastState(r)
+		return
+	}
+	window := m.rematchWindow(r)
+	r.Rematch = &model.Rematch{Players: ids, Accepted: []string{}, Declined: []string{}, Deadline: time.Now().Add(window)}
+	BroadcastInfo(r, fmt.Sprintf("要再来一局吗？%s内回应，座位将轮换，不再继续的玩家改为观战", durationText(window)))
+	m.BroadcastState(r)
+	m.scheduleRematch(r)
+}
+
+// scheduleRematch closes the room's rematch offer once its deadline passes.
+// An offer replaced in the meantime has its own timer.
+func (m *Manager) scheduleRematch(r *model.Room) {
+	rm := r.Rematch
+	time.AfterFunc(time.Until(rm.Deadline), func() {
+		r.Mutex.Lock()
+		defer r.Mutex.Unlock()
+		if r.Deleted {
+			return
+		}
+		if r.Rematch == rm {
+			m.closeRematch(r)
+		}
+	})
+}
+
+// AnswerRematch records whether playerID wants to play again and starts the
+// rematch once everyone asked has answered.
+// r 此时必须在外部被锁
+func (m *Manager) AnswerRematch(r *model.Room, playerID string, accept bool) error {
+	rm := r.Rematch
+	if rm == nil {
+		return ErrNoRematch
+	}
+	if !slices.Contains(rm.Players, playerID) {
+		return ErrNotInRematch
+	}
+	if slices.Contains(rm.Accepted, playerID) || slices.Contains(rm.Declined, playerID) {
+		return ErrRematchAnswered
+	}
+	if accept {
+		rm.Accepted = append(rm.Accepted, playerID)
+		BroadcastInfo(r, fmt.Sprintf("%s 同意再来一局", playerName(r, playerID)))
+	} else {
+		rm.Declined = append(rm.Declined, playerID)
+		BroadcastInfo(r, fmt.Sprintf("%s 不再继续", playerName(r, playerID)))
+	}
+	if len(rm.Accepted)+len(rm.Declined) == len(rm.Players) {
+		m.closeRematch(r)
+		return nil
+	}
+	m.BroadcastState(r)
+	return nil
+}
+
+// closeRematch settles the rematch offer: players who did not answer sit
+// the next game out, those who declined become spectators, and the rest
+// play again in rotated seats if there are enough of them.
+// r 此时必须在外部被锁
+func (m *Manager) closeRematch(r *model.Room) {
+	rm := r.Rematch
+	r.Rematch = nil
+	r.Seating = rotateSeating(r.Deal.DealOrder, rm.Accepted)
+	for _, id := range rm.Players {
+		p, ok := r.Players[id]
+		if !ok || slices.Contains(rm.Accepted, id) {
+			continue
+		}
+		p.Ready = false
+		if slices.Contains(rm.Declined, id) {
+			m.toSpectator(r, id)
+		} else {
+			p.SittingOut = true
+			BroadcastInfo(r, fmt.Sprintf("%s 没有回应，暂不参加下一局", p.Name))
+		}
+	}
+
+	if len(dealOrder(r)) < 2 {
+		resetRound(r)
+		BroadcastInfo(r, "同意再来一局的人数不足，回到等待状态")
+		m.BroadcastState(r)
+		return
+	}
+	names := []string{}
+	for _, id := range dealOrder(r) {
+		names = append(names, playerName(r, id))
+	}
+	BroadcastInfo(r, "再来一局！座位顺序："+strings.Join(names, "、"))
+	m.StartGame(r)
+}
+
+// rotateSeating moves every accepted player of the last game one seat on:
+// the first seat goes to the end and everyone else moves up.
+func rotateSeating(last, accepted []string) []string {
+	seating := []string{}
+	for _, id := range last {
+		if slices.Contains(accepted, id) {
+			seating = append(seating, id)
+		}
+	}
+	if len(seating) > 1 {
+		seating = append(seating[1:], seating[0])
+	}
+	return seating
+}
+
+// toSpectator moves a player who declined a rematch to the spectators, on
+// the same connection. A host whose guests play on keeps the device's seat
+// and sits out instead, and a guest simply leaves the device's seats.
+// r 此时必须在外部被锁
+func (m *Manager) toSpectator(r *model.Room, playerID string) {
+	p := r.Players[playerID]
+	if len(seatsOf(r, playerID)) > 1 {
+		p.SittingOut = true
+		BroadcastInfo(r, fmt.Sprintf("%s 暂不参加下一局", p.Name))
+		return
+	}
+	delete(r.Players, playerID)
+	leaveWaitingList(r, playerID)
+	if p.Conn != nil && !guest(p) {
+		if r.Spectators == nil {
+			r.Spectators = make(map[string]*model.Spectator)
+		}
+		r.Spectators[playerID] = &model.Spectator{ID: playerID, Name: p.Name, Conn: p.Conn}
+	}
+	BroadcastInfo(r, fmt.Sprintf("%s 改为观战", p.Name))
+	if r.OwnerID == playerID {
+		reassignOwner(r)
+	}
+}
+
+// reassignOwner gives the room of an owner who left r.Players to whoever
+// holds the first seat, or else to the remaining player with the lowest ID.
+// r 此时必须在外部被锁
+func reassignOwner(r *model.Room) {
+	next := ""
+	for _, id := range r.Seating {
+		if r.Players[id] != nil {
+			next = id
+			break
+		}
+	}
+	if next == "" {
+		for id := range r.Players {
+			if next == "" || id < next {
+				next = id
+			}
+		}
+	}
+	if next == "" {
+		return
+	}
+	r.OwnerID = next
+	BroadcastInfo(r, fmt.Sprintf("%s 成为新的房主", playerName(r, next)))
+}
+
+// extendSeries adds the game that just finished to the room's series,
+// starting one with the first game, and tells the table the totals so far.
+// Duplicate and tournament tables keep their own standings.
+// r 此时必须在外部被锁
+func extendSeries(r *model.Room, players map[string]*model.Player) string {
+	if r.DuplicateID != "" || r.TournamentID != "" || len(players) == 0 {
+		return ""
+	}
+	s := r.Series
+	if s == nil {
+		s = &model.Series{
+			ID:    fmt.Sprintf("%s-%d", r.ID, time.Now().UnixNano()),
+			Names: map[string]string{}, Totals: map[string]int{}, Wins: map[string]int{},
+		}
+		r.Series = s
+	}
+	s.Games++
+	best := -1
+	for id, p := range players {
+		s.Names[id] = p.Name
+		s.Totals[id] += p.Score
+		if best < 0 || p.Score < best {
+			best = p.Score
+		}
+	}
+	for id, p := range players {
+		if p.Score == best {
+			s.Wins[id]++
+		}
+	}
+	if s.Games > 1 {
+		BroadcastInfo(r, fmt.Sprintf("系列赛 %d 局累计：%s", s.Games, seriesText(s)))
+	}
+	return s.ID
+}
+
+// seriesText lists the series totals, fewest points first.
+func seriesText(s *model.Series) string {
+	ids := make([]string, 0, len(s.Totals))
+	for id := range s.Totals {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if s.Totals[ids[i]] != s.Totals[ids[j]] {
+			return s.Totals[ids[i]] < s.Totals[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	lines := make([]string, 0, len(ids))
+	for _, id := range ids {
+		lines = append(lines, fmt.Sprintf("%s %d 分 胜 %d 局", s.Names[id], s.Totals[id], s.Wins[id]))
+	}
+	return strings.Join(lines, " | ")
+}
+
+// EndSeries forgets the rematch offer, seating and series of a room that
+// starts over.
+// r 此时必须在外部被锁
+func EndSeries(r *model.Room) {
+	r.Rematch = nil
+	r.Seating = nil
+	r.Series = nil
+}
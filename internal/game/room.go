@@ -2,26 +2,38 @@ package game
 
 import (
 	"fmt"
-	"sort"
+	"slices"
 	"strings"
+	"take5/internal/engine"
+	"take5/internal/metrics"
 	"take5/internal/model"
 	"time"
 )
 
-// StartGame initializes and starts a new game round.
+// StartGame initializes and starts a new game round, dealing from the
+// committed upcoming seed mixed with the client seeds players contributed.
 func (m *Manager) StartGame(r *model.Room) {
-	InitDeck(r)
+	seed, clientSeeds := upcomingSeed(r), r.ClientSeeds
+	// The committed seed is used up; the following game draws a fresh one.
+	r.UpcomingSeed, r.SeedFixed, r.ClientSeeds = 0, false, nil
+	m.StartGameWithSeed(r, seed, clientSeeds)
+}
+
+// StartGameWithSeed starts a new game round whose deal is fully determined by
+// seed, the client seeds and the set of players.
+func (m *Manager) StartGameWithSeed(r *model.Room, seed int64, clientSeeds map[string]string) {
+	// Online players, late joiners included, up to the table's capacity
+	m.startDeal(r, seed, clientSeeds, dealOrder(r))
+}
+
+// startDeal deals a new game to order, hand k to order[k].
+func (m *Manager) startDeal(r *model.Room, seed int64, clientSeeds map[string]string, order []string) {
+	InitDeck(r, engine.NewDealRNG(engine.ShuffleKey(seed, clientSeeds)))
 	r.Status = "playing"
 	r.TurnQueue = make([]model.PlayAction, 0)
 	r.PendingPlay = nil
 
-	// Count online players to verify we can start
-	playingCount := 0
-	for _, p := range r.Players {
-		if p.IsOnline {
-			playingCount++
-		}
-	}
+	playingCount := len(order)
 
 	if playingCount < 2 {
 		r.Status = "waiting"
@@ -29,150 +41,232 @@ func (m *Manager) StartGame(r *model.Room) {
 		return
 	}
 
-	// Deal cards using rules.go helper
-	DealCards(r)
+	deck := deckValues(r.Deck)
+	r.Deal = model.DealRecord{
+		Seed:        seed,
+		SeedCommit:  SeedCommit(seed),
+		ClientSeeds: clientSeeds,
+		DeckCommit:  DeckCommit(seed, deck),
+		Deck:        deck,
+		DealOrder:   order,
+	}
+	seatWaiting(r, order)
+	for _, p := range r.Players {
+		p.Ready = false
+		p.Departed = false
+		p.BotAssisted = false
+	}
+	roomLogger(r).Info("game started", "players", playingCount, "seed", seed)
+	if err := m.apply(r, engine.Deal{Deck: r.Deck, Players: r.Deal.DealOrder}); err != nil {
+		r.Status = "waiting"
+		BroadcastInfo(r, "人数不足，无法开始")
+	}
+}
+
+// ReadyToStart reports whether a waiting room can start: tournament tables
+// need every seated entrant online and ready, other rooms two ready players.
+func ReadyToStart(r *model.Room) bool {
+	if len(r.Entrants) > 0 {
+		for _, pid := range r.Entrants {
+			if p := r.Players[pid]; p == nil || !p.IsOnline || !p.Ready {
+				return false
+			}
+		}
+		return true
+	}
+	readyCount := 0
+	for _, p := range r.Players {
+		if p.IsOnline && p.Ready && !p.SittingOut {
+			readyCount++
+		}
+	}
+	return readyCount >= 2
+}
+
+// PlayCard commits a player's card for the turn. Once every player with
+// cards left has chosen, the turn is revealed and resolved.
+// r 此时必须在外部被锁
+func (m *Manager) PlayCard(r *model.Room, playerID string, value int) error {
+	return m.apply(r, engine.PlayCard{PlayerID: playerID, Value: value})
+}
+
+// HandleRowChoice resolves a player's choice to take a specific row.
+// r 此时必须在外部被锁
+func (m *Manager) HandleRowChoice(r *model.Room, playerID string, rowIdx int) error {
+	return m.apply(r, engine.ChooseRow{PlayerID: playerID, Row: rowIdx})
+}
+
+// apply runs an action through the rules engine, stores the resulting state
+// in the room and turns the engine's events into broadcasts.
+// r 此时必须在外部被锁
+func (m *Manager) apply(r *model.Room, action engine.Action) error {
+	start := time.Now()
+	next, events, err := engine.Apply(engineState(r), action)
+	if err != nil {
+		roomLogger(r).Debug("action rejected", "action", fmt.Sprintf("%T", action), "error", err)
+		return err
+	}
+	storeEngineState(r, next)
 
+	resolving, nextTurn := false, false
+	for _, ev := range events {
+		switch ev := ev.(type) {
+		case engine.GameStarted, engine.TurnResolved:
+			nextTurn = true
+		case engine.TurnRevealed:
+			resolving = true
+		case engine.RowTaken:
+			resolving = true
+			name := playerName(r, ev.PlayerID)
+			if ev.Overflow {
+				roomLogger(r).Debug("row overflowed", "player_id", ev.PlayerID, "card", ev.Card.Value, "row", ev.Row, "penalty", ev.Penalty)
+				BroadcastInfo(r, fmt.Sprintf("%s 放置 %d，爆了第 %d 行！扣 %d 分", name, ev.Card.Value, ev.Row+1, ev.Penalty))
+			} else {
+				roomLogger(r).Debug("row taken", "player_id", ev.PlayerID, "card", ev.Card.Value, "row", ev.Row, "penalty", ev.Penalty)
+				BroadcastInfo(r, fmt.Sprintf("%s 收走第 %d 行，扣 %d 分", name, ev.Row+1, ev.Penalty))
+			}
+		case engine.RowChoiceNeeded:
+			nextTurn = true
+			BroadcastInfo(r, fmt.Sprintf("%s 的牌 %d 太小了，请选择一行收走", playerName(r, ev.PlayerID), ev.Card.Value))
+		case engine.PlayerForfeited:
+			BroadcastInfo(r, fmt.Sprintf("%s 弃权，%d 张手牌作废", playerName(r, ev.PlayerID), len(ev.Discarded)))
+		case engine.GameFinished:
+			r.TurnDeadline = time.Time{}
+			m.finishGame(r)
+			metrics.ObserveSince(metrics.TurnResolutionDuration, start)
+			return nil
+		}
+	}
+	if nextTurn {
+		m.startTurnClock(r)
+	}
 	m.BroadcastState(r)
+	if resolving {
+		metrics.ObserveSince(metrics.TurnResolutionDuration, start)
+	}
+	m.actForDeparted(r)
+	return nil
 }
 
-// PrepareTurnResolution collects selected cards and prepares the turn queue.
-func (m *Manager) PrepareTurnResolution(r *model.Room) {
-	r.TurnQueue = make([]model.PlayAction, 0)
+// engineState copies the parts of a room the rules engine works on.
+func engineState(r *model.Room) engine.State {
+	s := engine.State{
+		Status:      r.Status,
+		Rows:        r.Rows,
+		Hands:       make(map[string][]model.Card, len(r.Players)),
+		Scores:      make(map[string]int, len(r.Players)),
+		Piles:       make(map[string][]model.Card, len(r.Players)),
+		Selected:    make(map[string]model.Card),
+		TurnQueue:   r.TurnQueue,
+		PendingPlay: r.PendingPlay,
+		Revealed:    r.Revealed,
+	}
 	for id, p := range r.Players {
+		s.Hands[id] = p.Hand
+		s.Scores[id] = p.Score
+		s.Piles[id] = p.Pile
 		if p.SelectedCard != nil {
-			card := *p.SelectedCard
-			card.OwnerID = id
-			r.TurnQueue = append(r.TurnQueue, model.PlayAction{PlayerID: id, Card: card})
-			p.SelectedCard = nil
+			s.Selected[id] = *p.SelectedCard
 		}
 	}
-	sort.Slice(r.TurnQueue, func(i, j int) bool { return r.TurnQueue[i].Card.Value < r.TurnQueue[j].Card.Value })
-	m.ProcessTurnQueue(r)
+	return s
 }
 
-// ProcessTurnQueue resolves the actions in the turn queue.
-// r 此时比在外部被锁
-func (m *Manager) ProcessTurnQueue(r *model.Room) {
-	if len(r.TurnQueue) == 0 {
-		r.PendingPlay = nil
-		allEmpty := true
-		for _, p := range r.Players {
-			if len(p.Hand) > 0 {
-				allEmpty = false
-				break
-			}
+// storeEngineState writes an engine state back into the room. Players the
+// engine does not know about (not dealt in) are left with an empty hand.
+func storeEngineState(r *model.Room, s engine.State) {
+	r.Status = s.Status
+	r.Rows = s.Rows
+	r.TurnQueue = s.TurnQueue
+	if r.TurnQueue == nil {
+		r.TurnQueue = make([]model.PlayAction, 0)
+	}
+	r.PendingPlay = s.PendingPlay
+	r.Revealed = s.Revealed
+	for id, p := range r.Players {
+		p.Hand = s.Hands[id]
+		if p.Hand == nil {
+			p.Hand = []model.Card{}
 		}
-		if allEmpty {
-			r.Status = "finished"
-
-			// 广播结算状态，让客户端展示动画
-			m.BroadcastState(r)
-
-			// 延迟2秒，让玩家看到完整的上牌动画和准备进入结算
-			time.Sleep(2 * time.Second)
+		// A new deal drops everyone it skipped, so their old score goes too.
+		p.Score = s.Scores[id]
+		p.Pile = s.Piles[id]
+		if p.Pile == nil {
+			p.Pile = []model.Card{}
+		}
+		p.SelectedCard = nil
+		if c, ok := s.Selected[id]; ok {
+			p.SelectedCard = &c
+		}
+	}
+}
 
-			BroadcastInfo(r, "游戏结束！")
-			m.Store.RecordGameResult(r.ID, r.Players)
-			m.BroadcastStats(r)
+// playerName returns the display name of a seated player.
+func playerName(r *model.Room, playerID string) string {
+	if p, ok := r.Players[playerID]; ok {
+		return p.Name
+	}
+	return "未知玩家"
+}
 
-			// 再次广播最终状态，确保客户端显示最新积分
-			m.BroadcastState(r)
+// finishGame runs the end-of-game sequence once the engine reports the last
+// card placed: results, pauses for the client animation, then either the
+// duplicate/tournament hand-off or the rematch offer.
+// r 此时必须在外部被锁
+func (m *Manager) finishGame(r *model.Room) {
+	// Duplicate tables reveal the deal only once every table has played it.
+	if r.DuplicateID == "" {
+		lastDeal := r.Deal
+		r.LastDeal = &lastDeal
+	}
 
-			// 再延迟2秒展示结算画面
-			time.Sleep(2 * time.Second)
+	// 广播结算状态，让客户端展示动画
+	m.BroadcastState(r)
 
-			onlinePlayersCount := 0
-			for _, p := range r.Players {
-				if p.IsOnline {
-					onlinePlayersCount++
-				}
-			}
+	// 延迟2秒，让玩家看到完整的上牌动画和准备进入结算
+	time.Sleep(2 * time.Second)
 
-			scoreLines := []string{}
-			for _, p := range r.Players {
-				scoreLines = append(scoreLines, fmt.Sprintf("%s : %d 分", p.Name, p.Score))
-			}
-			BroadcastInfo(r, "本局得分："+strings.Join(scoreLines, " | "))
-
-			if onlinePlayersCount >= 2 {
-				// 开始倒计时，但保持状态为finished
-				for i := 5; i > 0; i-- {
-					for _, p := range r.Players {
-						if p.Conn != nil && p.IsOnline {
-							p.Conn.WriteJSON(model.Message{Type: "auto_restart_countdown", Payload: model.AutoRestartCountdownPayload{Count: i}})
-						}
-					}
-					time.Sleep(1 * time.Second)
-				}
-
-				// 倒计时结束，开始新游戏
-				m.StartGame(r)
-			} else {
-				BroadcastInfo(r, "在线人数不足，无法自动开始新一局。")
-			}
-		} else {
-			r.Status = "playing"
-			m.BroadcastState(r)
+	BroadcastInfo(r, "游戏结束！")
+	roomLogger(r).Info("game finished")
+	// Late joiners still waiting for a seat took no part in this game.
+	players := dealtPlayers(r)
+	m.Store.RecordGameResult(r.ID, r.Deal.Seed, extendSeries(r, players), players)
+	assisted := []string{}
+	for _, p := range players {
+		if p.BotAssisted {
+			assisted = append(assisted, p.Name)
 		}
-		return
 	}
-
-	currentPlay := r.TurnQueue[0]
-	card := currentPlay.Card
-
-	player := r.Players[currentPlay.PlayerID]
-	if player != nil {
-		newHand := make([]model.Card, 0)
-		for _, c := range player.Hand {
-			if c.Value != card.Value {
-				newHand = append(newHand, c)
-			}
-		}
-		player.Hand = newHand
+	if len(assisted) > 0 {
+		BroadcastInfo(r, fmt.Sprintf("%s 本局由机器人代打过，成绩不计入统计", strings.Join(assisted, "、")))
 	}
+	m.BroadcastStats(r)
 
-	bestRowIdx, _ := FindBestRow(r, card.Value)
+	// 再次广播最终状态，确保客户端显示最新积分
+	m.BroadcastState(r)
 
-	if bestRowIdx != -1 {
-		player := r.Players[currentPlay.PlayerID]
-		// Check for row overflow (taking the row)
-		if len(r.Rows[bestRowIdx].Cards) >= 5 {
-			rowScore := CalculateRowScore(r.Rows[bestRowIdx])
-			player.Score += rowScore
-			r.Rows[bestRowIdx].Cards = []model.Card{card}
-			BroadcastInfo(r, fmt.Sprintf("%s 放置 %d，爆了第 %d 行！扣 %d 分", player.Name, card.Value, bestRowIdx+1, rowScore))
-		} else {
-			r.Rows[bestRowIdx].Cards = append(r.Rows[bestRowIdx].Cards, card)
-		}
-		r.TurnQueue = r.TurnQueue[1:]
-		m.ProcessTurnQueue(r)
-	} else {
-		// Card is smaller than all row ends, player must choose a row
-		r.Status = "choosing_row"
-		r.PendingPlay = &currentPlay
-		pName := "未知玩家"
-		if p, ok := r.Players[currentPlay.PlayerID]; ok {
-			pName = p.Name
-		}
-		BroadcastInfo(r, fmt.Sprintf("%s 的牌 %d 太小了，请选择一行收走", pName, card.Value))
-		m.BroadcastState(r)
+	// 再延迟2秒展示结算画面
+	time.Sleep(2 * time.Second)
+
+	scoreLines := []string{}
+	for _, p := range players {
+		scoreLines = append(scoreLines, fmt.Sprintf("%s : %d 分", p.Name, p.Score))
 	}
-}
+	BroadcastInfo(r, "本局得分："+strings.Join(scoreLines, " | "))
 
-// HandleRowChoice resolves a player's choice to take a specific row.
-func (m *Manager) HandleRowChoice(r *model.Room, playerID string, rowIdx int) {
-	if r.Status != "choosing_row" || r.PendingPlay == nil || r.PendingPlay.PlayerID != playerID || rowIdx < 0 || rowIdx > 3 {
+	if r.DuplicateID != "" {
+		// 复式比赛的下一副由 duplicate.go 在各桌都准备好后统一开始
+		m.finishDuplicateTable(r)
+		return
+	}
+	if r.TournamentID != "" {
+		// 锦标赛每桌只打一局，下一轮由 tournament.go 重新分桌
+		m.finishTournamentTable(r)
 		return
 	}
-	player := r.Players[playerID]
-	rowScore := CalculateRowScore(r.Rows[rowIdx])
 
-	player.Score += rowScore
-	r.Rows[rowIdx].Cards = []model.Card{r.PendingPlay.Card}
-	BroadcastInfo(r, fmt.Sprintf("%s 收走第 %d 行，扣 %d 分", player.Name, rowIdx+1, rowScore))
-	r.TurnQueue = r.TurnQueue[1:]
-	r.PendingPlay = nil
-	m.ProcessTurnQueue(r)
+	// 询问本局玩家是否再来一局，座位轮换
+	m.offerRematch(r)
 }
 
 // ForceRestart allows the owner to restart the game manually.
@@ -181,21 +275,82 @@ func (m *Manager) ForceRestart(r *model.Room, requesterID string) bool {
 		return false
 	}
 
-	onlinePlayersCount := 0
-	for _, p := range r.Players {
-		if p.IsOnline {
-			onlinePlayersCount++
-		}
-	}
+	onlinePlayersCount := len(dealOrder(r))
 
 	if onlinePlayersCount < 2 {
 		BroadcastInfo(r, "人数不足，无法强制重开")
 		return false
 	}
 
-	// Reset game state
+	m.dropAdjournment(r)
+	resetRound(r)
+
+	BroadcastInfo(r, fmt.Sprintf("%s 强制重开了一局新游戏！", r.Players[requesterID].Name))
+	m.StartGame(r)
+	return true
+}
+
+// SetNextSeed lets the owner fix the server seed of the next deal. A nil seed
+// goes back to a random one. Client seeds are still mixed in either way.
+func (m *Manager) SetNextSeed(r *model.Room, requesterID string, seed *int64) bool {
+	if r.OwnerID != requesterID {
+		return false
+	}
+	if seed == nil {
+		r.UpcomingSeed = 0
+		upcomingSeed(r)
+		BroadcastInfo(r, "房主取消了指定种子，下一局将随机发牌")
+	} else {
+		r.UpcomingSeed = *seed
+		r.SeedFixed = true
+		BroadcastInfo(r, "房主指定了下一局的发牌种子")
+	}
+	m.BroadcastState(r)
+	return true
+}
+
+// ReplayDeal abandons whatever is in progress and starts a new game from the
+// seeds of the last finished game, dealt in its recorded order, so the same
+// players receive exactly the same hands and starting rows. Every player of
+// that game has to be able to play; anyone else waits for the next game.
+func (m *Manager) ReplayDeal(r *model.Room, requesterID string) bool {
+	if r.OwnerID != requesterID || r.LastDeal == nil {
+		return false
+	}
+
+	available := dealOrder(r)
+	if len(available) < 2 {
+		BroadcastInfo(r, "人数不足，无法重玩上一局")
+		return false
+	}
+	last := *r.LastDeal
+	for _, id := range last.DealOrder {
+		if !slices.Contains(available, id) {
+			BroadcastInfo(r, fmt.Sprintf("%s 不在牌桌上，无法按原座位重玩上一局", playerName(r, id)))
+			return false
+		}
+	}
+
+	m.dropAdjournment(r)
+	resetRound(r)
+	BroadcastInfo(r, fmt.Sprintf("%s 选择重玩上一局的牌 (种子 %d)", r.Players[requesterID].Name, last.Seed))
+	m.startDeal(r, last.Seed, last.ClientSeeds, last.DealOrder)
+	queued := false
+	for _, id := range available {
+		queued = QueueLateJoiner(r, id) || queued
+	}
+	if queued {
+		m.BroadcastState(r)
+	}
+	return true
+}
+
+// resetRound clears hands, scores and rows and puts the room back to waiting,
+// ending any rematch series.
+func resetRound(r *model.Room) {
 	for _, p := range r.Players {
 		p.Hand = []model.Card{}
+		p.Pile = []model.Card{}
 		p.Score = 0
 		p.Ready = false
 		p.SelectedCard = nil
@@ -205,9 +360,9 @@ func (m *Manager) ForceRestart(r *model.Room, requesterID string) bool {
 	}
 	r.TurnQueue = make([]model.PlayAction, 0)
 	r.PendingPlay = nil
+	r.Revealed = nil
 	r.Status = "waiting"
-
-	BroadcastInfo(r, fmt.Sprintf("%s 强制重开了一局新游戏！", r.Players[requesterID].Name))
-	m.StartGame(r)
-	return true
+	r.PausedStatus = ""
+	r.TurnDeadline = time.Time{}
+	EndSeries(r)
 }
@@ -0,0 +1,50 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"take5/internal/model"
+)
+
+var ErrSettingsOwner = errors.New("只有房主可以修改房间设置")
+
+// UpdateSettings lets the owner replace the room settings and tells the
+// table what changed. r 此时必须在外部被锁
+func (m *Manager) UpdateSettings(r *model.Room, requesterID string, s model.RoomSettings) error {
+	if r.OwnerID != requesterID {
+		return ErrSettingsOwner
+	}
+	if _, ok := departureNames[s.Departure]; !ok && s.Departure != "" {
+		return ErrUnknownDeparture
+	}
+	if s.Correspondence != r.Settings.Correspondence && gameRunning(r) {
+		return ErrCorrespondenceInGame
+	}
+	if s.NoAdvisor != r.Settings.NoAdvisor {
+		if s.NoAdvisor {
+			BroadcastInfo(r, "房主关闭了出牌提示")
+		} else {
+			BroadcastInfo(r, "房主开启了出牌提示")
+		}
+	}
+	if s.CardTracker != r.Settings.CardTracker {
+		if s.CardTracker {
+			BroadcastInfo(r, "房主开启了记牌器")
+		} else {
+			BroadcastInfo(r, "房主关闭了记牌器")
+		}
+	}
+	if policy := departurePolicy(s); policy != departurePolicy(r.Settings) {
+		BroadcastInfo(r, "房主将中途离开的处理方式改为："+departureNames[policy])
+	}
+	if s.Correspondence != r.Settings.Correspondence {
+		if s.Correspondence {
+			BroadcastInfo(r, fmt.Sprintf("房主开启了通信对局：不必在线，每回合最长等待 %s", durationText(m.TurnDeadline)))
+		} else {
+			BroadcastInfo(r, "房主关闭了通信对局")
+		}
+	}
+	r.Settings = s
+	m.BroadcastState(r)
+	return nil
+}
@@ -0,0 +1,494 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
+	"take5/internal/engine"
+	"take5/internal/model"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// Tournaments.
+//
+// An organizer creates a tournament from the lobby and players register.
+// Once started, every round seats the active entrants into new rooms that
+// only they can play in. Each table plays a single game; its bullheads are
+// collected right after RecordGameResult, and when every table of the round
+// is done the next round is seated.
+//
+// Swiss: everyone plays every round, and tables group players with similar
+// cumulative bullheads. Knockout: the better half of each table advances
+// until the remaining players fit on one final table.
+//
+// A table whose entrants have not all turned up and got ready within
+// Manager.NoShowWindow starts without the absent ones, who forfeit: they
+// score as many bullheads as the worst player at the table and are the
+// first knocked out. With fewer than two entrants present the table is
+// settled without a game.
+//
+// Lock order: t.Mutex, then RoomsLock, a room's Mutex or LobbyLock; never
+// the other way round. Code holding a room lock reports to the tournament
+// from a goroutine.
+
+// DefaultNoShowWindow is Manager.NoShowWindow unless configured.
+const DefaultNoShowWindow = 5 * time.Minute
+
+const (
+	TournamentSwiss         = "swiss"
+	TournamentKnockout      = "knockout"
+	MaxTournamentRounds     = 10
+	MaxTournamentNameLength = 40
+)
+
+var (
+	ErrTournamentNotFound  = errors.New("锦标赛不存在")
+	ErrTournamentConfig    = fmt.Errorf("锦标赛设置无效：名称 1-%d 字，每桌 2-%d 人，瑞士制 1-%d 轮", MaxTournamentNameLength, engine.MaxPlayers, MaxTournamentRounds)
+	ErrTournamentClosed    = errors.New("锦标赛已经开始，无法报名或退出")
+	ErrTournamentOrganizer = errors.New("只有组织者可以开始锦标赛")
+	ErrTournamentTooFew    = errors.New("至少需要 2 名选手才能开始")
+)
+
+// CreateTournament opens registration for a new tournament organized by the
+// user on conn.
+func (m *Manager) CreateTournament(conn *websocket.Conn, cfg model.TournamentConfig) (*model.Tournament, error) {
+	organizerID, organizerName := m.lobbyIdentity(conn)
+	if organizerID == "" {
+		return nil, ErrNotIdentified
+	}
+	cfg.Name = strings.TrimSpace(cfg.Name)
+	if n := utf8.RuneCountInString(cfg.Name); n == 0 || n > MaxTournamentNameLength ||
+		cfg.TableSize < 2 || cfg.TableSize > engine.MaxPlayers {
+		return nil, ErrTournamentConfig
+	}
+	switch cfg.Format {
+	case TournamentSwiss:
+		if cfg.Rounds < 1 || cfg.Rounds > MaxTournamentRounds {
+			return nil, ErrTournamentConfig
+		}
+	case TournamentKnockout:
+		cfg.Rounds = 0
+	default:
+		return nil, ErrTournamentConfig
+	}
+
+	t := &model.Tournament{TournamentState: model.TournamentState{
+		Name: cfg.Name, OrganizerID: organizerID, OrganizerName: organizerName,
+		Format: cfg.Format, Rounds: cfg.Rounds, TableSize: cfg.TableSize,
+		Status: "registering", Entrants: []model.TournamentEntrant{},
+	}}
+	m.TournamentsLock.Lock()
+	for t.ID == "" || m.Tournaments[t.ID] != nil {
+		t.ID = fmt.Sprintf("T%04X", rand.IntN(0x10000))
+	}
+	m.Tournaments[t.ID] = t
+	m.TournamentsLock.Unlock()
+
+	m.Store.PersistTournament(&t.TournamentState)
+	slog.Info("tournament created", "tournament_id", t.ID, "player_id", organizerID, "format", t.Format)
+	go m.BroadcastTournaments()
+	return t, nil
+}
+
+// JoinTournament registers the user on conn for a tournament.
+func (m *Manager) JoinTournament(conn *websocket.Conn, id string) error {
+	return m.updateRegistration(conn, id, func(t *model.Tournament, playerID, name string) {
+		for _, e := range t.Entrants {
+			if e.ID == playerID {
+				return
+			}
+		}
+		t.Entrants = append(t.Entrants, model.TournamentEntrant{ID: playerID, Name: name})
+	})
+}
+
+// LeaveTournament withdraws the user on conn before the tournament starts.
+func (m *Manager) LeaveTournament(conn *websocket.Conn, id string) error {
+	return m.updateRegistration(conn, id, func(t *model.Tournament, playerID, _ string) {
+		for i, e := range t.Entrants {
+			if e.ID == playerID {
+				t.Entrants = append(t.Entrants[:i], t.Entrants[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+func (m *Manager) updateRegistration(conn *websocket.Conn, id string, update func(t *model.Tournament, playerID, name string)) error {
+	playerID, name := m.lobbyIdentity(conn)
+	if playerID == "" {
+		return ErrNotIdentified
+	}
+	t := m.tournament(id)
+	if t == nil {
+		return ErrTournamentNotFound
+	}
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+	if t.Status != "registering" {
+		return ErrTournamentClosed
+	}
+	update(t, playerID, name)
+	m.Store.PersistTournament(&t.TournamentState)
+	go m.BroadcastTournaments()
+	return nil
+}
+
+// StartTournament closes registration and seats the first round.
+func (m *Manager) StartTournament(conn *websocket.Conn, id string) error {
+	playerID, _ := m.lobbyIdentity(conn)
+	t := m.tournament(id)
+	if t == nil {
+		return ErrTournamentNotFound
+	}
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+	if t.OrganizerID != playerID {
+		return ErrTournamentOrganizer
+	}
+	if t.Status != "registering" {
+		return ErrTournamentClosed
+	}
+	if len(t.Entrants) < 2 {
+		return ErrTournamentTooFew
+	}
+	t.Status = "running"
+	m.seatRound(t)
+	m.Store.PersistTournament(&t.TournamentState)
+	slog.Info("tournament started", "tournament_id", t.ID, "entrants", len(t.Entrants))
+	go m.BroadcastTournaments()
+	return nil
+}
+
+// seatRound starts the next round: it groups the active entrants into
+// tables, creates a room per table and invites the players to it.
+// t 此时必须在外部被锁
+func (m *Manager) seatRound(t *model.Tournament) {
+	t.Round++
+	active := make([]model.TournamentEntrant, 0, len(t.Entrants))
+	for _, e := range t.Entrants {
+		if e.Eliminated == 0 {
+			active = append(active, e)
+		}
+	}
+	// Shuffle first so ties (everyone on round 1) are broken at random.
+	rand.Shuffle(len(active), func(i, j int) { active[i], active[j] = active[j], active[i] })
+	sort.SliceStable(active, func(i, j int) bool { return active[i].Penalty < active[j].Penalty })
+
+	groups := groupEntrants(active, t.Format, t.TableSize)
+	t.Tables = make([]model.TournamentTable, 0, len(groups))
+	for i, players := range groups {
+		r := NewRoom(fmt.Sprintf("%s-R%d-%d", t.ID, t.Round, i+1), t.OrganizerID)
+		r.TournamentID = t.ID
+		r.Entrants = players
+		r.Settings.NoAdvisor = true // 比赛桌不提供出牌提示
+		r.NoShowAt = time.Now().Add(m.NoShowWindow)
+		for m.AddRoom(r) != nil {
+			r.ID += "x"
+		}
+		m.scheduleNoShow(r)
+		t.Tables = append(t.Tables, model.TournamentTable{RoomID: r.ID, Players: players})
+	}
+	go m.BroadcastRoomList()
+
+	from := fmt.Sprintf("锦标赛「%s」第 %d 轮", t.Name, t.Round)
+	m.LobbyLock.Lock()
+	for _, table := range t.Tables {
+		msg := model.Message{Type: "invite", Payload: model.Invite{FromID: t.OrganizerID, FromName: from, RoomID: table.RoomID}}
+		for c, u := range m.LobbyConns {
+			for _, pid := range table.Players {
+				if u.ID == pid {
+					writeLobby(c, msg)
+				}
+			}
+		}
+	}
+	m.LobbyLock.Unlock()
+	slog.Info("tournament round seated", "tournament_id", t.ID, "round", t.Round, "tables", len(t.Tables))
+}
+
+// groupEntrants splits the active entrants, best first, into tables of at
+// most tableSize. A table needs two players to start, so when the entrants
+// do not fill the tables evenly there are fewer, larger tables instead.
+func groupEntrants(active []model.TournamentEntrant, format string, tableSize int) [][]string {
+	tables := (len(active) + tableSize - 1) / tableSize
+	if tables > len(active)/2 {
+		tables = len(active) / 2
+	}
+	groups := make([][]string, tables)
+	if format == TournamentKnockout {
+		// Snake seeding spreads the leaders over the tables.
+		for i, e := range active {
+			k := i % tables
+			if (i/tables)%2 == 1 {
+				k = tables - 1 - k
+			}
+			groups[k] = append(groups[k], e.ID)
+		}
+		return groups
+	}
+	// Swiss: neighbours in the standings share a table, and table sizes
+	// differ by at most one.
+	next := 0
+	for k := range groups {
+		size := len(active) / tables
+		if k < len(active)%tables {
+			size++
+		}
+		for _, e := range active[next : next+size] {
+			groups[k] = append(groups[k], e.ID)
+		}
+		next += size
+	}
+	return groups
+}
+
+// scheduleNoShow starts a tournament table without its absent entrants once
+// its no-show deadline passes.
+func (m *Manager) scheduleNoShow(r *model.Room) {
+	time.AfterFunc(time.Until(r.NoShowAt), func() {
+		r.Mutex.Lock()
+		defer r.Mutex.Unlock()
+		if r.Deleted {
+			return
+		}
+		m.closeNoShow(r)
+	})
+}
+
+// closeNoShow forfeits the entrants of a tournament table who are not there
+// at the no-show deadline and starts the game for the rest, ready or not.
+// Tables left with fewer than two entrants are settled without a game.
+// r 此时必须在外部被锁
+func (m *Manager) closeNoShow(r *model.Room) {
+	if r.NoShowAt.IsZero() || r.Status != "waiting" || r.LastDeal != nil {
+		return
+	}
+	r.NoShowAt = time.Time{}
+	present := []string{}
+	for _, pid := range r.Entrants {
+		if p := r.Players[pid]; p != nil && p.IsOnline && !p.SittingOut {
+			present = append(present, pid)
+			continue
+		}
+		if p := r.Players[pid]; p != nil {
+			BroadcastInfo(r, fmt.Sprintf("%s 未按时到场，按弃权处理", p.Name))
+			delete(r.Players, pid)
+			leaveWaitingList(r, pid)
+		}
+		r.NoShows = append(r.NoShows, pid)
+	}
+	r.Entrants = present
+	roomLogger(r).Info("tournament table no-show deadline passed", "present", len(present), "no_shows", len(r.NoShows))
+	if len(present) < 2 {
+		BroadcastInfo(r, "到场选手不足两人，本桌不开局")
+		m.finishTournamentTable(r)
+		m.BroadcastState(r)
+		m.Store.PersistRoom(r)
+		return
+	}
+	if len(r.NoShows) > 0 {
+		BroadcastInfo(r, fmt.Sprintf("到场截止，%d 名选手缺席，比赛开始", len(r.NoShows)))
+	} else {
+		BroadcastInfo(r, "到场截止，比赛开始")
+	}
+	m.StartGame(r)
+}
+
+// finishTournamentTable reports a finished table's bullheads to its
+// tournament. r 此时必须在外部被锁
+func (m *Manager) finishTournamentTable(r *model.Room) {
+	scores := make(map[string]int, len(r.Entrants))
+	for _, pid := range r.Entrants {
+		if p := r.Players[pid]; p != nil {
+			scores[pid] = p.Score
+		}
+	}
+	BroadcastInfo(r, "本桌比赛结束，成绩已计入锦标赛，请回到大厅等待下一轮")
+	go m.recordTournamentTable(r.TournamentID, r.ID, scores, r.NoShows)
+}
+
+// recordTournamentTable adds a table's result to the standings and, once the
+// whole round is in, eliminates knockout losers and seats the next round or
+// ends the tournament. Entrants who did not show up score as many bullheads
+// as the worst player at the table.
+func (m *Manager) recordTournamentTable(id, roomID string, scores map[string]int, noShows []string) {
+	t := m.tournament(id)
+	if t == nil {
+		return
+	}
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+	if t.Status != "running" {
+		return
+	}
+	idx := -1
+	for i, table := range t.Tables {
+		if table.RoomID == roomID && !table.Done {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return
+	}
+	worst := 0
+	for _, s := range scores {
+		worst = max(worst, s)
+	}
+	for _, pid := range noShows {
+		scores[pid] = worst
+	}
+	t.Tables[idx].Scores = scores
+	t.Tables[idx].NoShows = noShows
+	t.Tables[idx].Done = true
+	for i := range t.Entrants {
+		if s, ok := scores[t.Entrants[i].ID]; ok {
+			t.Entrants[i].Penalty += s
+			if !slices.Contains(noShows, t.Entrants[i].ID) {
+				t.Entrants[i].Games++
+			}
+		}
+	}
+
+	roundDone := true
+	for _, table := range t.Tables {
+		roundDone = roundDone && table.Done
+	}
+	if roundDone {
+		t.History = append(t.History, t.Tables)
+		final := len(t.Tables) == 1
+		if t.Format == TournamentKnockout {
+			m.eliminate(t, final)
+		}
+		if (t.Format == TournamentSwiss && t.Round >= t.Rounds) || (t.Format == TournamentKnockout && final) {
+			t.Status = "finished"
+			t.Tables = nil
+			slog.Info("tournament finished", "tournament_id", t.ID, "rounds", t.Round)
+		} else {
+			m.seatRound(t)
+		}
+	}
+	m.Store.PersistTournament(&t.TournamentState)
+	go m.BroadcastTournaments()
+}
+
+// eliminate knocks out the worse half of every table of the round just
+// played, no-shows first; at the final table only the winner stays in.
+// t 此时必须在外部被锁
+func (m *Manager) eliminate(t *model.Tournament, final bool) {
+	penalty := make(map[string]int, len(t.Entrants))
+	for _, e := range t.Entrants {
+		penalty[e.ID] = e.Penalty
+	}
+	out := make(map[string]bool)
+	for _, table := range t.Tables {
+		players := append([]string(nil), table.Players...)
+		sort.SliceStable(players, func(i, j int) bool {
+			a, b := players[i], players[j]
+			if absentA, absentB := slices.Contains(table.NoShows, a), slices.Contains(table.NoShows, b); absentA != absentB {
+				return absentB
+			}
+			if table.Scores[a] != table.Scores[b] {
+				return table.Scores[a] < table.Scores[b]
+			}
+			return penalty[a] < penalty[b]
+		})
+		advance := (len(players) + 1) / 2
+		if final {
+			advance = 1
+		}
+		for _, pid := range players[advance:] {
+			out[pid] = true
+		}
+	}
+	for i := range t.Entrants {
+		if out[t.Entrants[i].ID] {
+			t.Entrants[i].Eliminated = t.Round
+		}
+	}
+}
+
+// TournamentList returns snapshots of every tournament: running ones first,
+// then open registrations, then finished ones.
+func (m *Manager) TournamentList() []model.TournamentState {
+	m.TournamentsLock.Lock()
+	all := make([]*model.Tournament, 0, len(m.Tournaments))
+	for _, t := range m.Tournaments {
+		all = append(all, t)
+	}
+	m.TournamentsLock.Unlock()
+
+	list := make([]model.TournamentState, 0, len(all))
+	for _, t := range all {
+		t.Mutex.Lock()
+		list = append(list, snapshotTournament(t))
+		t.Mutex.Unlock()
+	}
+	order := map[string]int{"running": 0, "registering": 1, "finished": 2}
+	sort.Slice(list, func(i, j int) bool {
+		if order[list[i].Status] != order[list[j].Status] {
+			return order[list[i].Status] < order[list[j].Status]
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// TournamentStandings returns a snapshot of one tournament with its entrants
+// in standings order.
+func (m *Manager) TournamentStandings(id string) (model.TournamentState, bool) {
+	t := m.tournament(id)
+	if t == nil {
+		return model.TournamentState{}, false
+	}
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+	return snapshotTournament(t), true
+}
+
+// BroadcastTournaments pushes the tournament list to every lobby connection.
+func (m *Manager) BroadcastTournaments() {
+	msg := model.Message{Type: "tournaments", Payload: m.TournamentList()}
+	m.LobbyLock.Lock()
+	defer m.LobbyLock.Unlock()
+	for c := range m.LobbyConns {
+		writeLobby(c, msg)
+	}
+}
+
+// snapshotTournament copies the state of t with entrants sorted into
+// standings: players still in first, then by how late they were knocked
+// out, then by fewest bullheads. t 此时必须在外部被锁
+func snapshotTournament(t *model.Tournament) model.TournamentState {
+	s := t.TournamentState
+	s.Entrants = append([]model.TournamentEntrant(nil), t.Entrants...)
+	s.Tables = append([]model.TournamentTable(nil), t.Tables...)
+	s.History = append([][]model.TournamentTable(nil), t.History...)
+	sort.SliceStable(s.Entrants, func(i, j int) bool {
+		a, b := s.Entrants[i], s.Entrants[j]
+		if (a.Eliminated == 0) != (b.Eliminated == 0) {
+			return a.Eliminated == 0
+		}
+		if a.Eliminated != b.Eliminated {
+			return a.Eliminated > b.Eliminated
+		}
+		if a.Penalty != b.Penalty {
+			return a.Penalty < b.Penalty
+		}
+		return a.Name < b.Name
+	})
+	return s
+}
+
+func (m *Manager) tournament(id string) *model.Tournament {
+	m.TournamentsLock.Lock()
+	defer m.TournamentsLock.Unlock()
+	return m.Tournaments[id]
+}
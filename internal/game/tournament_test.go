@@ -0,0 +1,115 @@
+package game
+
+import (
+	"fmt"
+	"slices"
+	"take5/internal/model"
+	"testing"
+)
+
+func entrants(n int) []model.TournamentEntrant {
+	es := make([]model.TournamentEntrant, n)
+	for i := range es {
+		es[i] = model.TournamentEntrant{ID: fmt.Sprintf("p%d", i+1), Penalty: i}
+	}
+	return es
+}
+
+func TestGroupEntrants(t *testing.T) {
+	for _, tc := range []struct {
+		format     string
+		n, size    int
+		wantTables []int
+	}{
+		{TournamentSwiss, 3, 2, []int{3}},
+		{TournamentSwiss, 5, 2, []int{3, 2}},
+		{TournamentSwiss, 7, 4, []int{4, 3}},
+		{TournamentSwiss, 9, 4, []int{3, 3, 3}},
+		{TournamentKnockout, 3, 2, []int{3}},
+		{TournamentKnockout, 7, 3, []int{3, 2, 2}},
+		{TournamentKnockout, 8, 4, []int{4, 4}},
+	} {
+		groups := groupEntrants(entrants(tc.n), tc.format, tc.size)
+		sizes := []int{}
+		for _, g := range groups {
+			sizes = append(sizes, len(g))
+		}
+		if !slices.Equal(sizes, tc.wantTables) {
+			t.Errorf("%s with %d entrants at tables of %d: sizes %v, want %v", tc.format, tc.n, tc.size, sizes, tc.wantTables)
+		}
+	}
+
+	// Swiss keeps neighbours in the standings together; knockout snakes the leaders apart.
+	if got := groupEntrants(entrants(4), TournamentSwiss, 2); !slices.Equal(got[0], []string{"p1", "p2"}) {
+		t.Errorf("swiss first table %v, want the two leaders", got[0])
+	}
+	if got := groupEntrants(entrants(4), TournamentKnockout, 2); !slices.Equal(got[0], []string{"p1", "p4"}) {
+		t.Errorf("knockout first table %v, want the leader with the last seed", got[0])
+	}
+}
+
+func TestEliminate(t *testing.T) {
+	tr := &model.Tournament{}
+	tr.Format = TournamentKnockout
+	tr.Round = 1
+	tr.Entrants = entrants(5)
+	tr.Tables = []model.TournamentTable{
+		{Players: []string{"p1", "p3", "p5"}, Scores: map[string]int{"p1": 20, "p3": 4, "p5": 9}},
+		// A tie on the table goes to the better standing.
+		{Players: []string{"p2", "p4"}, Scores: map[string]int{"p2": 7, "p4": 7}},
+	}
+	(&Manager{}).eliminate(tr, false)
+	out := []string{}
+	for _, e := range tr.Entrants {
+		if e.Eliminated != 0 {
+			out = append(out, e.ID)
+		}
+	}
+	if !slices.Equal(out, []string{"p1", "p4"}) {
+		t.Errorf("eliminated %v, want [p1 p4]", out)
+	}
+
+	tr.Round = 2
+	tr.Tables = []model.TournamentTable{{Players: []string{"p2", "p3", "p5"}, Scores: map[string]int{"p2": 12, "p3": 15, "p5": 3}}}
+	(&Manager{}).eliminate(tr, true)
+	for _, e := range tr.Entrants {
+		if (e.Eliminated == 0) != (e.ID == "p5") {
+			t.Errorf("after the final %s eliminated in round %d, want only p5 left", e.ID, e.Eliminated)
+		}
+	}
+}
+
+func TestEliminateNoShows(t *testing.T) {
+	tr := &model.Tournament{}
+	tr.Format = TournamentKnockout
+	tr.Round = 1
+	tr.Entrants = entrants(3)
+	// p1 stands best but did not show up; scored like p3, p1 still goes out.
+	tr.Tables = []model.TournamentTable{{
+		Players: []string{"p1", "p2", "p3"},
+		Scores:  map[string]int{"p1": 10, "p2": 3, "p3": 10},
+		NoShows: []string{"p1"},
+	}}
+	(&Manager{}).eliminate(tr, false)
+	for _, e := range tr.Entrants {
+		if (e.Eliminated != 0) != (e.ID == "p1") {
+			t.Errorf("%s eliminated in round %d, want only p1 out", e.ID, e.Eliminated)
+		}
+	}
+}
+
+func TestRotateSeats(t *testing.T) {
+	lineup := []string{"a", "b", "c"}
+	held := map[string][]string{}
+	for board := range lineup {
+		for seat, id := range rotateSeats(lineup, board) {
+			held[id] = append(held[id], fmt.Sprint(seat))
+		}
+	}
+	for id, seats := range held {
+		slices.Sort(seats)
+		if !slices.Equal(seats, []string{"0", "1", "2"}) {
+			t.Errorf("%s held seats %v over the match, want each seat once", id, seats)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"take5/internal/model"
+	"time"
+)
+
+// Vote kinds. Any seated player may call one; the outcome is applied with
+// the same room methods the owner's own actions use.
+const (
+	VoteKick    = "kick"    // 踢出一名玩家
+	VoteRestart = "restart" // 作废本局并重新发牌
+	VoteAbort   = "abort"   // 中止本局，回到等待状态
+	VotePause   = "pause"   // 暂停进行中的对局
+	VoteResume  = "resume"  // 继续已暂停的对局
+	VoteAdjourn = "adjourn" // 休会，改天再继续
+)
+
+// DefaultVoteTimeout is Manager.VoteTimeout unless configured.
+const DefaultVoteTimeout = 30 * time.Second
+
+var (
+	ErrUnknownVote   = errors.New("未知的投票类型")
+	ErrVoteActive    = errors.New("已经有一个投票在进行中")
+	ErrNoVote        = errors.New("当前没有进行中的投票")
+	ErrNotVoter      = errors.New("你没有这次投票的投票权")
+	ErrAlreadyVoted  = errors.New("你已经投过票了")
+	ErrVoteTarget    = errors.New("投票踢出的玩家不在房间中")
+	ErrVoteTooFew    = errors.New("在场人数太少，无法发起投票")
+	ErrVoteNotNeeded = errors.New("现在不能发起这项投票")
+)
+
+// voters returns the players entitled to vote on a proposal about target:
+// everyone online who is seated for play, target excluded.
+func voters(r *model.Room, target string) []string {
+	ids := []string{}
+	for id, p := range r.Players {
+		if id != target && p.IsOnline && !p.SittingOut && !waiting(r, id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// voteApplies reports whether a vote of kind could change anything in r now.
+func voteApplies(r *model.Room, kind, target string) error {
+	switch kind {
+	case VoteKick:
+		if _, ok := r.Players[target]; !ok {
+			return ErrVoteTarget
+		}
+	case VoteRestart:
+		if len(dealOrder(r)) < 2 {
+			return ErrVoteNotNeeded
+		}
+	case VoteAbort:
+		if !gameRunning(r) {
+			return ErrVoteNotNeeded
+		}
+	case VotePause:
+		if !inProgress(r) {
+			return ErrVoteNotNeeded
+		}
+	case VoteAdjourn:
+		if !inProgress(r) && r.Status != StatusPaused {
+			return ErrVoteNotNeeded
+		}
+	case VoteResume:
+		if r.Status != StatusPaused {
+			return ErrVoteNotNeeded
+		}
+	default:
+		return ErrUnknownVote
+	}
+	return nil
+}
+
+// voteText describes a proposal for the table.
+func voteText(r *model.Room, v *model.Vote) string {
+	switch v.Kind {
+	case VoteKick:
+		return "踢出 " + playerName(r, v.Target)
+	case VoteRestart:
+		return "重开一局"
+	case VoteAbort:
+		return "中止本局"
+	case VotePause:
+		return "暂停对局"
+	case VoteAdjourn:
+		return "休会"
+	default:
+		return "继续对局"
+	}
+}
+
+// CallVote opens a vote of kind, with the caller's yes already counted.
+// r 此时必须在外部被锁
+func (m *Manager) CallVote(r *model.Room, callerID, kind, target string) error {
+	m.expireVote(r)
+	if r.Vote != nil {
+		return ErrVoteActive
+	}
+	if err := voteApplies(r, kind, target); err != nil {
+		return err
+	}
+	ids := voters(r, target)
+	if !slices.Contains(ids, callerID) {
+		return ErrNotVoter
+	}
+	if len(ids) < 2 {
+		return ErrVoteTooFew
+	}
+	if kind != VoteKick {
+		target = ""
+	}
+	v := &model.Vote{
+		Kind: kind, Target: target, CallerID: callerID, Voters: ids,
+		Yes: []string{callerID}, No: []string{}, Deadline: time.Now().Add(m.VoteTimeout),
+	}
+	r.Vote = v
+	BroadcastInfo(r, fmt.Sprintf("%s 发起投票：%s（%d 秒内过半数同意即通过）", playerName(r, callerID), voteText(r, v), int(m.VoteTimeout/time.Second)))
+	m.BroadcastState(r)
+
+	time.AfterFunc(m.VoteTimeout, func() {
+		r.Mutex.Lock()
+		defer r.Mutex.Unlock()
+		if r.Deleted {
+			return
+		}
+		if r.Vote == v {
+			m.closeVote(r, false)
+		}
+	})
+	return nil
+}
+
+// CastVote records a yes or no and closes the vote as soon as its outcome
+// is decided.
+// r 此时必须在外部被锁
+func (m *Manager) CastVote(r *model.Room, voterID string, yes bool) error {
+	m.expireVote(r)
+	v := r.Vote
+	if v == nil {
+		return ErrNoVote
+	}
+	if !slices.Contains(v.Voters, voterID) {
+		return ErrNotVoter
+	}
+	if slices.Contains(v.Yes, voterID) || slices.Contains(v.No, voterID) {
+		return ErrAlreadyVoted
+	}
+	if yes {
+		v.Yes = append(v.Yes, voterID)
+	} else {
+		v.No = append(v.No, voterID)
+	}
+
+	majority := len(v.Voters)/2 + 1
+	switch {
+	case len(v.Yes) >= majority:
+		m.closeVote(r, true)
+	case len(v.Voters)-len(v.No) < majority:
+		m.closeVote(r, false)
+	default:
+		m.BroadcastState(r)
+	}
+	return nil
+}
+
+// expireVote fails a vote whose deadline passed without its timer firing,
+// as happens to a vote restored from the database after a restart.
+func (m *Manager) expireVote(r *model.Room) {
+	if r.Vote != nil && time.Now().After(r.Vote.Deadline) {
+		m.closeVote(r, false)
+	}
+}
+
+// closeVote ends the active vote and, if it passed, applies its outcome.
+// r 此时必须在外部被锁
+func (m *Manager) closeVote(r *model.Room, passed bool) {
+	v := r.Vote
+	r.Vote = nil
+	if !passed {
+		BroadcastInfo(r, fmt.Sprintf("投票未通过：%s（赞成 %d / 反对 %d / 共 %d 人）", voteText(r, v), len(v.Yes), len(v.No), len(v.Voters)))
+		m.BroadcastState(r)
+		return
+	}
+	BroadcastInfo(r, fmt.Sprintf("投票通过：%s（赞成 %d / 反对 %d / 共 %d 人）", voteText(r, v), len(v.Yes), len(v.No), len(v.Voters)))
+	// The room may have moved on since the vote was called.
+	if err := voteApplies(r, v.Kind, v.Target); err != nil {
+		BroadcastInfo(r, "投票结果已无法执行："+err.Error())
+		m.BroadcastState(r)
+		return
+	}
+	switch v.Kind {
+	case VoteKick:
+		m.kick(r, v.Target, v.CallerID)
+	case VoteRestart:
+		m.dropAdjournment(r)
+		resetRound(r)
+		m.StartGame(r)
+	case VoteAbort:
+		m.dropAdjournment(r)
+		resetRound(r)
+		BroadcastInfo(r, "本局已中止，不计成绩")
+		m.BroadcastState(r)
+	case VotePause:
+		m.Pause(r)
+	case VoteResume:
+		m.Resume(r)
+	case VoteAdjourn:
+		m.Adjourn(r)
+	}
+}
+
+// kick removes a player from r for good. A seat dealt into the running game
+// is handed to the departure policy so the game can finish; otherwise the
+// player is dropped at once. A kicked owner's room goes to newOwnerID.
+// r 此时必须在外部被锁
+func (m *Manager) kick(r *model.Room, playerID, newOwnerID string) {
+	p := r.Players[playerID]
+	r.Kicked = append(r.Kicked, playerID)
+	// A hot-seat guest shares its host's connection, which stays open.
+	if p.Conn != nil && !guest(p) {
+		send(r, playerID, p.Conn, model.Message{Type: "kicked", Payload: "你已被投票移出房间"})
+		p.Conn.Close()
+	}
+	p.Conn = nil
+	p.Host = ""
+	p.IsOnline = false
+	p.Ready = false
+	leaveWaitingList(r, playerID)
+	BroadcastInfo(r, fmt.Sprintf("%s 已被投票移出房间", p.Name))
+	if r.OwnerID == playerID {
+		r.OwnerID = newOwnerID
+		BroadcastInfo(r, fmt.Sprintf("%s 成为新的房主", playerName(r, newOwnerID)))
+	}
+	if r.Status == StatusAdjourned {
+		m.releaseParticipant(r, playerID)
+	} else if len(p.Hand) > 0 && gameRunning(r) {
+		// Unlike leaving, being kicked hands the seat over in correspondence games too.
+		if !p.Departed {
+			m.handOver(r, p)
+		}
+	} else if !gameRunning(r) || !slices.Contains(r.Deal.DealOrder, playerID) {
+		// A dealt player's score still counts towards the running game's result.
+		delete(r.Players, playerID)
+	}
+	m.BroadcastState(r)
+}
+
+// leaveWaitingList drops playerID from the waiting list, if queued.
+func leaveWaitingList(r *model.Room, playerID string) {
+	r.WaitingList = slices.DeleteFunc(r.WaitingList, func(id string) bool { return id == playerID })
+}
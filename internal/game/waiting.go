@@ -0,0 +1,112 @@
+package game
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"take5/internal/engine"
+	"take5/internal/model"
+)
+
+// inProgress reports whether a game is being played in r.
+func inProgress(r *model.Room) bool {
+	return r.Status == engine.StatusPlaying || r.Status == engine.StatusChoosingRow
+}
+
+// waiting reports whether playerID is queued for the next deal.
+func waiting(r *model.Room, playerID string) bool {
+	return slices.Contains(r.WaitingList, playerID)
+}
+
+// seatedCount returns the number of players who are not waiting for a seat.
+func seatedCount(r *model.Room) int {
+	n := 0
+	for id := range r.Players {
+		if !waiting(r, id) {
+			n++
+		}
+	}
+	return n
+}
+
+// QueueLateJoiner puts a player who just joined r on the waiting list when a
+// game they were not dealt into is running, or every seat is taken. They are
+// seated by the next deal that has room for them.
+// r 此时必须在外部被锁
+func QueueLateJoiner(r *model.Room, playerID string) bool {
+	p, ok := r.Players[playerID]
+	if !ok || waiting(r, playerID) {
+		return false
+	}
+	if gameRunning(r) && slices.Contains(r.Deal.DealOrder, playerID) {
+		return false
+	}
+	if !gameRunning(r) && seatedCount(r) <= engine.MaxPlayers {
+		return false
+	}
+	r.WaitingList = append(r.WaitingList, playerID)
+	if gameRunning(r) {
+		BroadcastInfo(r, fmt.Sprintf("%s 加入了等候名单，下一局开始时入座", p.Name))
+	} else {
+		BroadcastInfo(r, fmt.Sprintf("房间已满，%s 加入了等候名单", p.Name))
+	}
+	return true
+}
+
+// seatWaiting takes the players dealt into the new game off the waiting list
+// and tells those still queued that the table was full.
+// r 此时必须在外部被锁
+func seatWaiting(r *model.Room, dealt []string) {
+	var seated, left []string
+	for _, id := range r.WaitingList {
+		p := r.Players[id]
+		if p == nil {
+			continue
+		}
+		if slices.Contains(dealt, id) {
+			seated = append(seated, p.Name)
+		} else {
+			left = append(left, p.Name)
+		}
+	}
+	r.WaitingList = slices.DeleteFunc(r.WaitingList, func(id string) bool {
+		return r.Players[id] == nil || slices.Contains(dealt, id)
+	})
+	if len(seated) > 0 {
+		BroadcastInfo(r, fmt.Sprintf("%s 从等候名单入座", strings.Join(seated, "、")))
+	}
+	if len(left) > 0 {
+		BroadcastInfo(r, fmt.Sprintf("本局人数已满，%s 继续等候", strings.Join(left, "、")))
+	}
+}
+
+// dealtPlayers returns the players dealt into the current game: late
+// joiners waiting for a seat are not part of its result.
+func dealtPlayers(r *model.Room) map[string]*model.Player {
+	players := make(map[string]*model.Player, len(r.Deal.DealOrder))
+	for _, id := range r.Deal.DealOrder {
+		if p, ok := r.Players[id]; ok {
+			players[id] = p
+		}
+	}
+	return players
+}
+
+// ToggleSitOut switches whether playerID sits out the following games. A
+// player sitting out stays in the room but is neither dealt in nor counted
+// as ready until they toggle back; a game already running is not affected.
+// r 此时必须在外部被锁
+func (m *Manager) ToggleSitOut(r *model.Room, playerID string) {
+	p, ok := r.Players[playerID]
+	if !ok {
+		return
+	}
+	p.SittingOut = !p.SittingOut
+	if p.SittingOut {
+		p.Ready = false
+		BroadcastInfo(r, fmt.Sprintf("%s 暂不参加接下来的对局", p.Name))
+	} else {
+		BroadcastInfo(r, fmt.Sprintf("%s 回到牌桌，下一局参加", p.Name))
+	}
+	m.BroadcastState(r)
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// RoomsByStatus is refreshed every time the lobby room list is rebuilt.
+	RoomsByStatus = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "take5_rooms",
+		Help: "Number of rooms by status.",
+	}, []string{"status"})
+
+	LobbyConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "take5_lobby_connections",
+		Help: "Open lobby WebSocket connections.",
+	})
+
+	GameConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "take5_game_connections",
+		Help: "Open game WebSocket connections.",
+	})
+
+	Actions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "take5_actions_total",
+		Help: "Actions received from game clients by type.",
+	}, []string{"type"})
+
+	Errors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "take5_errors_total",
+		Help: "Errors by source.",
+	}, []string{"source"})
+
+	BroadcastDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "take5_broadcast_duration_seconds",
+		Help:    "Time spent fanning a message out to every recipient.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+	}, []string{"kind"})
+
+	DBWriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "take5_db_write_duration_seconds",
+		Help:    "SQLite write latency by operation.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+	}, []string{"op"})
+
+	TurnResolutionDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "take5_turn_resolution_duration_seconds",
+		Help:    "Time spent resolving a turn, including end-of-game pauses.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+	})
+)
+
+// Error sources used with Errors.
+const (
+	SourceWebSocketWrite = "ws_write"
+	SourceUpgrade        = "ws_upgrade"
+	SourceDatabase       = "database"
+	SourceClient         = "client"
+)
+
+// ObserveSince records the seconds elapsed since start.
+func ObserveSince(o prometheus.Observer, start time.Time) {
+	o.Observe(time.Since(start).Seconds())
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -18,30 +19,258 @@ type Player struct {
 	Conn         *websocket.Conn `json:"-"`
 	Hand         []Card          `json:"hand"`
 	Score        int             `json:"score"`
+	Pile         []Card          `json:"pile"` // 本局收走的牌（罚牌堆）
 	Ready        bool            `json:"ready"`
 	SelectedCard *Card           `json:"selectedCard"`
 	IsOnline     bool            `json:"isOnline"`
+	OfflineSince time.Time       `json:"-"`           // 最近一次断线的时间，用于断线宽限期
+	Departed     bool            `json:"departed"`    // 对局中已按离开处理，由房间的离场策略代为行动
+	BotAssisted  bool            `json:"botAssisted"` // 本局有牌是由机器人代为打出的
+	SittingOut   bool            `json:"sittingOut"`  // 暂不参加接下来的对局，留在房间但不发牌
+	Host         string          `json:"host"`        // 同屏模式下替本座位连线的玩家ID，空表示用自己的连接
+	ActiveSeat   string          `json:"activeSeat"`  // 同屏模式的主座：设备当前交给了哪个座位，空表示自己
+	RecentChats  []time.Time     `json:"-"`           // 用于聊天限流
+}
+
+// Spectator is a read-only connection to a room. Spectators are not persisted.
+type Spectator struct {
+	ID   string
+	Name string
+	Conn *websocket.Conn
+}
+
+// LobbyUser is the identity behind a lobby connection. ID is empty until the
+// client says hello.
+type LobbyUser struct {
+	ID   string
+	Name string
 }
 
 type Row struct {
 	Cards []Card `json:"cards"`
 }
 
+// RoomSettings are the per-room options the owner can change. The zero value
+// is the default for casual rooms.
+type RoomSettings struct {
+	NoAdvisor   bool   `json:"noAdvisor"`   // 关闭出牌提示，竞技房间使用
+	CardTracker bool   `json:"cardTracker"` // 向玩家下发未见牌和各行空档（记牌器）
+	Departure   string `json:"departure"`   // 对局中离开的玩家如何处理："lowest"、"bot" 或 "forfeit"，空为 "bot"
+	// 通信对局：玩家不必在线，每回合等所有人出牌或到截止时间才结算
+	Correspondence bool `json:"correspondence"`
+}
+
+// Vote is a decision put to the players seated in a room. It passes once a
+// strict majority of Voters say yes and fails when that can no longer
+// happen or Deadline passes.
+type Vote struct {
+	Kind     string    `json:"kind"`     // "kick"、"restart"、"abort"、"pause" 或 "resume"
+	Target   string    `json:"target"`   // 被提议踢出的玩家ID，仅 kick 使用
+	CallerID string    `json:"callerId"` // 发起人，自动投赞成票
+	Voters   []string  `json:"voters"`   // 有投票权的玩家ID
+	Yes      []string  `json:"yes"`
+	No       []string  `json:"no"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// Rematch is the offer to play again made to the players of a game that
+// just finished. Players who decline watch the next game; those who have not
+// answered by Deadline sit it out.
+type Rematch struct {
+	Players  []string  `json:"players"`  // 上一局在线的玩家ID，需要回应
+	Accepted []string  `json:"accepted"` // 同意再来一局的玩家
+	Declined []string  `json:"declined"` // 不再继续的玩家，下一局改为观战
+	Deadline time.Time `json:"deadline"`
+}
+
+// Series links the games a room played back to back through rematches, so
+// head-to-head totals can be kept across them.
+type Series struct {
+	ID     string            `json:"id"`
+	Games  int               `json:"games"`  // 已完成的局数
+	Names  map[string]string `json:"names"`  // 玩家ID到昵称，离开的玩家也保留
+	Totals map[string]int    `json:"totals"` // 累计牛头数
+	Wins   map[string]int    `json:"wins"`   // 获胜局数，并列最低分都算胜
+}
+
+// UnseenView is what one player has not seen yet this game: the cards still
+// in other hands or never dealt, and how they fall between the row ends.
+type UnseenView struct {
+	Cards []int    `json:"cards"`
+	Below int      `json:"below"` // 比所有行尾都小的未见牌数
+	Rows  []RowGap `json:"rows"`
+}
+
+// RowGap is the range of cards that would land on one row.
+type RowGap struct {
+	Row    int   `json:"row"`
+	End    int   `json:"end"`    // 行尾
+	Next   int   `json:"next"`   // 下一个更大的行尾，没有则为 105
+	Unseen int   `json:"unseen"` // 区间内的未见牌数
+	Mine   []int `json:"mine"`   // 区间内自己的手牌
+	Room   int   `json:"room"`   // 还能放几张牌而不爆行
+}
+
+// CardAdvice is the advisor's estimate for playing one card this turn.
+type CardAdvice struct {
+	Card            int     `json:"card"`
+	Row             int     `json:"row"`             // 预计落入的行，-1 表示比所有行尾都小
+	Undercut        bool    `json:"undercut"`        // 比所有行尾都小，必须自选收走一行
+	TakeChance      float64 `json:"takeChance"`      // 需要收走一行的概率
+	ExpectedPenalty float64 `json:"expectedPenalty"` // 预计扣除的牛头数
+}
+
 type PlayAction struct {
 	PlayerID string
 	Card     Card
 }
 
 type Room struct {
-	ID          string
-	OwnerID     string // 房主ID
-	Players     map[string]*Player
-	Rows        [4]Row
-	Status      string
-	Deck        []Card
-	TurnQueue   []PlayAction
-	PendingPlay *PlayAction
-	Mutex       sync.Mutex `json:"-"`
+	ID           string
+	OwnerID      string // 房主ID
+	Players      map[string]*Player
+	Spectators   map[string]*Spectator `json:"-"`
+	Rows         [4]Row
+	Status       string
+	Deck         []Card
+	TurnQueue    []PlayAction
+	PendingPlay  *PlayAction
+	Deal         DealRecord        // 当前一局的发牌记录，种子与牌序在结束前不公开
+	LastDeal     *DealRecord       // 最近一局已结束对局的发牌记录（已公开）
+	UpcomingSeed int64             // 下一局的服务器种子，只公开其哈希承诺
+	SeedFixed    bool              // 下一局种子是否由房主指定
+	ClientSeeds  map[string]string // 玩家为下一局提供的客户端种子
+	LastActive   time.Time         // 最近一次房间活动时间，供过期清理使用
+	StaleWarned  bool              // 是否已发出即将清理的提醒
+	DuplicateID  string            // 所属复式比赛，空表示普通房间
+	Board        int               // 复式比赛中本桌正在进行的副数（从0开始）
+	SeatOrder    []string          // 复式比赛本副的座位顺序，即发牌顺序
+	TournamentID string            // 所属锦标赛，空表示普通房间
+	Entrants     []string          // 锦标赛指定的本桌选手，其他人只能观战
+	NoShowAt     time.Time         // 锦标赛本桌选手的到场截止时间，到时不等缺席的选手直接开局
+	NoShows      []string          // 锦标赛本桌未按时到场、按弃权处理的选手
+	Revealed     []Card            // 本局已公开过的牌：行首和每回合亮出的牌
+	Settings     RoomSettings      // 房主可调整的房间设置
+	WaitingList  []string          // 对局进行中加入或房间已满时排队的玩家，按加入先后，下一局发牌时入座
+	Vote         *Vote             // 进行中的投票，同一时间只有一个
+	Kicked       []string          // 被投票踢出的玩家，不能再以玩家身份加入
+	PausedStatus string            // 暂停前的状态，恢复时还原
+	Participants []string          // 休会时在座的玩家，全部回到房间后对局才继续
+	TurnDeadline time.Time         // 通信对局本回合的截止时间，到时未出牌的玩家自动出最小的牌
+	Rematch      *Rematch          // 对局结束后进行中的再来一局邀请
+	Seating      []string          // 再来一局轮换后的座位顺序，发牌时优先按此排列
+	Series       *Series           // 通过再来一局连起来的系列赛累计成绩
+	Deleted      bool              `json:"-"` // 已解散或被清理，之后到期的计时器不能再改动和保存它
+	Mutex        sync.Mutex        `json:"-"`
+}
+
+// DealRecord holds everything needed to reproduce and independently verify a
+// deal: the server seed, the client seeds mixed into it, the published
+// commitments and the resulting deck order.
+type DealRecord struct {
+	Seed        int64             `json:"seed,string"` // 以字符串传输，避免浏览器丢失精度
+	SeedCommit  string            `json:"seedCommit"`  // sha256(种子)，开局前公布
+	ClientSeeds map[string]string `json:"clientSeeds"` // 玩家ID -> 客户端种子
+	DeckCommit  string            `json:"deckCommit"`  // sha256(种子:牌序)，开局时公布
+	Deck        []int             `json:"deck"`        // 洗好的牌序
+	DealOrder   []string          `json:"dealOrder"`   // 依次拿牌的玩家ID
+}
+
+// DuplicateMatch links several rooms (tables) that play the same sequence of
+// deals. Seats rotate between boards so that, over a full match, every
+// player has played every seat's cards.
+type DuplicateMatch struct {
+	ID      string
+	OwnerID string
+	Tables  []string                  // 关联的房间ID，按桌号排列
+	Seats   int                       // 每桌人数
+	Boards  int                       // 总副数，默认等于座位数（完整轮换一次）
+	Seeds   []int64                   // 每副牌的种子，比赛结束前不公开
+	Lineups map[string][]string       // 房间ID -> 首副的入座顺序
+	Names   map[string]string         // 玩家ID -> 昵称
+	Results []DuplicateBoard          // 已完成各副的成绩
+	Pending map[string]DuplicateTable // 当前副已完成的各桌成绩
+	Mutex   sync.Mutex                `json:"-"`
+}
+
+// DuplicateBoard is the outcome of one deal across every table.
+type DuplicateBoard struct {
+	Seed   int64                     `json:"seed,string"`
+	Tables map[string]DuplicateTable `json:"tables"` // 房间ID -> 本桌成绩
+}
+
+// DuplicateTable records who sat where at one table and what each seat scored.
+type DuplicateTable struct {
+	Seating []string `json:"seating"` // 各座位的玩家ID
+	Scores  []int    `json:"scores"`  // 各座位本副的牛头数
+}
+
+// DuplicateStanding is one player's line in the cross-table scoreboard.
+type DuplicateStanding struct {
+	PlayerID    string `json:"playerId"`
+	Name        string `json:"name"`
+	Table       string `json:"table"`
+	MatchPoints int    `json:"matchPoints"` // 与其他桌同座位比较：少者得2分，相同各得1分
+	Penalty     int    `json:"penalty"`     // 累计牛头数
+}
+
+type DuplicateScoreboard struct {
+	ID        string              `json:"id"`
+	Tables    []string            `json:"tables"`
+	Seats     int                 `json:"seats"`
+	Boards    int                 `json:"boards"`
+	Played    int                 `json:"played"`
+	Results   []DuplicateBoard    `json:"results"`
+	Standings []DuplicateStanding `json:"standings"`
+	Names     map[string]string   `json:"names"`
+}
+
+// Tournament is a multi-round event run by an organizer. Each round seats the
+// remaining entrants into fresh rooms.
+type Tournament struct {
+	TournamentState
+	Mutex sync.Mutex `json:"-"`
+}
+
+// TournamentState is the serializable part of a Tournament, also used as the
+// snapshot published to the lobby and over HTTP.
+type TournamentState struct {
+	ID            string              `json:"id"`
+	Name          string              `json:"name"`
+	OrganizerID   string              `json:"organizerId"`
+	OrganizerName string              `json:"organizerName"`
+	Format        string              `json:"format"`    // "swiss" 瑞士制 或 "knockout" 淘汰制
+	Rounds        int                 `json:"rounds"`    // 瑞士制的轮数；淘汰制打到决出冠军为止
+	TableSize     int                 `json:"tableSize"` // 每桌最多人数
+	Status        string              `json:"status"`    // "registering" / "running" / "finished"
+	Round         int                 `json:"round"`     // 当前轮次，从1开始，报名阶段为0
+	Entrants      []TournamentEntrant `json:"entrants"`
+	Tables        []TournamentTable   `json:"tables"`  // 当前轮各桌
+	History       [][]TournamentTable `json:"history"` // 已结束各轮
+}
+
+type TournamentEntrant struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Penalty    int    `json:"penalty"`              // 累计牛头数
+	Games      int    `json:"games"`                // 已完成局数
+	Eliminated int    `json:"eliminated,omitempty"` // 淘汰制中被淘汰的轮次，0 表示仍在比赛
+}
+
+type TournamentTable struct {
+	RoomID  string         `json:"roomId"`
+	Players []string       `json:"players"`
+	Scores  map[string]int `json:"scores,omitempty"`  // 本桌结束后各选手的牛头数
+	NoShows []string       `json:"noShows,omitempty"` // 未按时到场、按弃权处理的选手
+	Done    bool           `json:"done"`
+}
+
+// TournamentConfig is what an organizer fills in to create a tournament.
+type TournamentConfig struct {
+	Name      string `json:"name"`
+	Format    string `json:"format"`
+	Rounds    int    `json:"rounds"`
+	TableSize int    `json:"tableSize"`
 }
 
 type RoomSummary struct {
@@ -49,6 +278,40 @@ type RoomSummary struct {
 	OwnerName   string `json:"ownerName"`
 	PlayerCount int    `json:"playerCount"`
 	Status      string `json:"status"`
+	ExpiresAt   int64  `json:"expiresAt,omitempty"`  // 即将被清理时的 Unix 时间戳
+	Duplicate   string `json:"duplicate,omitempty"`  // 所属复式比赛
+	Tournament  string `json:"tournament,omitempty"` // 所属锦标赛
+
+	Correspondence bool `json:"correspondence,omitempty"` // 通信对局
+}
+
+type PresenceEntry struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	RoomID string `json:"roomId,omitempty"` // 所在房间，空表示在大厅
+}
+
+// SavedGame is an adjourned game as listed in the lobby: it resumes once
+// every participant is back in the room.
+type SavedGame struct {
+	RoomID       string    `json:"roomId"`
+	Participants []string  `json:"participants"` // 需要全部回来才能继续的玩家ID
+	Names        []string  `json:"names"`        // 参与者昵称，与 Participants 一一对应
+	AdjournedAt  time.Time `json:"adjournedAt"`
+}
+
+// YourMove is a correspondence game waiting on one player, as listed in
+// their lobby.
+type YourMove struct {
+	RoomID   string    `json:"roomId"`
+	Status   string    `json:"status"`   // "playing" 需要出牌，"choosing_row" 需要选行
+	Deadline time.Time `json:"deadline"` // 本回合截止时间
+}
+
+type Invite struct {
+	FromID   string `json:"fromId"`
+	FromName string `json:"fromName"`
+	RoomID   string `json:"roomId"`
 }
 
 type Message struct {
@@ -64,8 +327,12 @@ type Action struct {
 	RoomID  string `json:"roomId"`
 }
 
-type AutoRestartCountdownPayload struct {
-	Count int `json:"count"`
+type ChatMessage struct {
+	PlayerID string `json:"playerId"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"` // "chat" 或 "emote"
+	Text     string `json:"text"`
+	SentAt   int64  `json:"sentAt"` // Unix 毫秒
 }
 
 type PlayerStat struct {
@@ -3,10 +3,15 @@ package server
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"take5/internal/database"
 	"take5/internal/game"
+	"take5/internal/logging"
+	"take5/internal/metrics"
 	"take5/internal/model"
 
 	"github.com/gorilla/websocket"
@@ -14,6 +19,36 @@ import (
 
 var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
 
+// knownActions bounds the label values of the actions counter.
+var knownActions = map[string]bool{
+	"create_room": true, "login": true, "delete_room": true, "leave_room": true,
+	"ready": true, "play_card": true, "choose_row": true, "force_restart": true, "restart": true,
+	"spectate": true, "chat": true, "emote": true,
+	"hello": true, "lobby_chat": true, "invite": true,
+	"set_seed": true, "replay_deal": true, "client_seed": true, "create_duplicate": true,
+	"tournament_create": true, "tournament_join": true, "tournament_leave": true, "tournament_start": true,
+	"advise": true, "room_settings": true, "sit_out": true, "vote_call": true, "vote": true,
+	"pause": true, "resume": true, "adjourn": true, "add_seat": true, "switch_seat": true, "rematch": true,
+}
+
+// scheduledLocked lists the actions that would break the games a duplicate
+// match or tournament schedules, and are therefore refused in their rooms.
+var scheduledLocked = map[string]bool{
+	"force_restart": true, "restart": true, "set_seed": true, "replay_deal": true, "room_settings": true,
+	"sit_out": true, "vote_call": true, "pause": true, "resume": true, "adjourn": true, "add_seat": true,
+}
+
+// seatActions are played by one seat. On a connection holding several seats
+// (hot-seat play) the action's ID names the seat, defaulting to the one the
+// device is handed to.
+var seatActions = map[string]bool{
+	"ready": true, "sit_out": true, "play_card": true, "choose_row": true, "advise": true, "vote": true, "rematch": true,
+}
+
+// handActions are the seat actions that play from or reveal the seat's hand;
+// a shared device may only take them for the seat it is handed to.
+var handActions = map[string]bool{"play_card": true, "choose_row": true, "advise": true}
+
 type Handler struct {
 	Manager *game.Manager
 	Store   *database.Store
@@ -28,88 +63,251 @@ func (h *Handler) CheckRoomHandler(w http.ResponseWriter, r *http.Request) {
 	h.Manager.RoomsLock.Lock()
 	_, exists := h.Manager.Rooms[roomID]
 	h.Manager.RoomsLock.Unlock()
-	json.NewEncoder(w).Encode(map[string]bool{"exists": exists})
+	if err := json.NewEncoder(w).Encode(map[string]bool{"exists": exists}); err != nil {
+		slog.Warn("failed to write check_room response", "request_id", logging.RequestID(r), "room_id", roomID, "err", err)
+	}
+}
+
+// VerifyDealHandler reveals the last finished deal of a room together with
+// the result of checking it against its published commitments.
+func (h *Handler) VerifyDealHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.URL.Query().Get("room")
+	h.Manager.RoomsLock.Lock()
+	room, exists := h.Manager.Rooms[roomID]
+	h.Manager.RoomsLock.Unlock()
+
+	var deal *model.DealRecord
+	if exists {
+		room.Mutex.Lock()
+		if room.LastDeal != nil {
+			d := *room.LastDeal
+			deal = &d
+		}
+		room.Mutex.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if deal == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "该房间还没有已结束的对局"})
+		return
+	}
+	resp := map[string]interface{}{"deal": deal, "valid": true}
+	if err := game.VerifyDeal(*deal); err != nil {
+		resp["valid"] = false
+		resp["error"] = err.Error()
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Warn("failed to write verify_deal response", "request_id", logging.RequestID(r), "room_id", roomID, "err", err)
+	}
+}
+
+// DuplicateHandler returns the cross-table scoreboard of a duplicate match.
+func (h *Handler) DuplicateHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	w.Header().Set("Content-Type", "application/json")
+	scoreboard, ok := h.Manager.DuplicateScoreboard(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "复式比赛不存在"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(scoreboard); err != nil {
+		slog.Warn("failed to write duplicate response", "request_id", logging.RequestID(r), "duplicate_id", id, "err", err)
+	}
+}
+
+// TournamentsHandler lists every tournament with its standings, or a single
+// one when ?id= is given.
+func (h *Handler) TournamentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var resp interface{} = h.Manager.TournamentList()
+	if id := r.URL.Query().Get("id"); id != "" {
+		t, ok := h.Manager.TournamentStandings(id)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": game.ErrTournamentNotFound.Error()})
+			return
+		}
+		resp = t
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Warn("failed to write tournaments response", "request_id", logging.RequestID(r), "err", err)
+	}
+}
+
+// writeTo sends a message on a connection, logging failed writes with the
+// connection's logger.
+func writeTo(logger *slog.Logger, ws *websocket.Conn, msg model.Message) {
+	if err := game.WriteJSON(ws, msg); err != nil {
+		metrics.Errors.WithLabelValues(metrics.SourceWebSocketWrite).Inc()
+		logger.Warn("failed to write message", "msg_type", msg.Type, "err", err)
+	}
+}
+
+// dropDecliner removes the spectator entry a player who declined a rematch
+// was given on ws, once they leave or take a seat again.
+// r 此时必须在外部被锁
+func dropDecliner(r *model.Room, playerID string, ws *websocket.Conn) {
+	if sp, ok := r.Spectators[playerID]; ok && sp.Conn == ws {
+		delete(r.Spectators, playerID)
+	}
 }
 
 func (h *Handler) HandleLobbyWS(w http.ResponseWriter, r *http.Request) {
+	// One ID for the whole connection, so its log lines can be followed
+	// across hello, login and room changes.
+	requestID := logging.RequestID(r)
+	logger := slog.With("request_id", requestID)
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		metrics.Errors.WithLabelValues(metrics.SourceUpgrade).Inc()
+		logger.Warn("lobby websocket upgrade failed", "err", err)
 		return
 	}
+	logger.Debug("lobby connected", "remote_addr", r.RemoteAddr)
+	metrics.LobbyConnections.Inc()
+	defer metrics.LobbyConnections.Dec()
 
-	h.Manager.LobbyLock.Lock()
-	h.Manager.LobbyConns[ws] = true
-	h.Manager.LobbyLock.Unlock()
-
-	go h.Manager.BroadcastRoomList()
+	h.Manager.JoinLobby(ws)
 
 	defer func() {
-		h.Manager.LobbyLock.Lock()
-		delete(h.Manager.LobbyConns, ws)
-		h.Manager.LobbyLock.Unlock()
+		h.Manager.LeaveLobby(ws)
 		ws.Close()
+		game.ReleaseConn(ws)
 	}()
 
 	for {
-		if _, _, err := ws.ReadMessage(); err != nil {
+		var action model.Action
+		if err := ws.ReadJSON(&action); err != nil {
+			logger.Debug("lobby disconnected", "err", err)
 			break
 		}
+		countAction(action.Type)
+		logger.Debug("lobby action received", "action", action.Type)
+
+		var err error
+		switch action.Type {
+		case "hello":
+			name := strings.TrimSpace(action.Payload)
+			if name == "" {
+				continue
+			}
+			uid := h.Store.GetOrCreateUserID(name)
+			logger = slog.With("request_id", requestID, "player_id", uid)
+			h.Manager.IdentifyLobbyUser(ws, uid, name)
+		case "lobby_chat":
+			err = h.Manager.HandleLobbyChat(ws, action.Payload)
+		case "invite":
+			err = h.Manager.SendInvite(ws, action.ID, action.RoomID)
+			if err == nil {
+				h.Manager.SendLobbyInfo(ws, "邀请已发送")
+			}
+		case "tournament_create":
+			var cfg model.TournamentConfig
+			if json.Unmarshal([]byte(action.Payload), &cfg) != nil {
+				err = game.ErrTournamentConfig
+				break
+			}
+			var t *model.Tournament
+			if t, err = h.Manager.CreateTournament(ws, cfg); err == nil {
+				h.Manager.SendLobbyInfo(ws, fmt.Sprintf("锦标赛 %s 已创建，等待选手报名", t.ID))
+			}
+		case "tournament_join":
+			err = h.Manager.JoinTournament(ws, action.ID)
+		case "tournament_leave":
+			err = h.Manager.LeaveTournament(ws, action.ID)
+		case "tournament_start":
+			err = h.Manager.StartTournament(ws, action.ID)
+		}
+		if err != nil {
+			h.Manager.SendLobbyInfo(ws, err.Error())
+		}
+	}
+}
+
+// countAction increments the actions counter, folding unexpected types into
+// "unknown" to keep label cardinality bounded.
+func countAction(actionType string) {
+	if knownActions[actionType] {
+		metrics.Actions.WithLabelValues(actionType).Inc()
+	} else {
+		metrics.Actions.WithLabelValues("unknown").Inc()
 	}
 }
 
 func (h *Handler) HandleGameWS(w http.ResponseWriter, r *http.Request) {
+	// One ID for the whole connection, so its log lines can be followed
+	// across hello, login and room changes.
+	requestID := logging.RequestID(r)
+	logger := slog.With("request_id", requestID)
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		metrics.Errors.WithLabelValues(metrics.SourceUpgrade).Inc()
+		logger.Warn("game websocket upgrade failed", "err", err)
 		return
 	}
+	logger.Debug("game connected", "remote_addr", r.RemoteAddr)
+	metrics.GameConnections.Inc()
+	defer metrics.GameConnections.Dec()
 
 	var currentRoom *model.Room
 	var currentPlayerID string
+	var spectating bool
 
 	defer func() {
-		if currentRoom != nil {
+		if currentRoom != nil && spectating {
 			currentRoom.Mutex.Lock()
-			if p, ok := currentRoom.Players[currentPlayerID]; ok {
+			delete(currentRoom.Spectators, currentPlayerID)
+			currentRoom.Mutex.Unlock()
+			logger.Info("spectator disconnected")
+		} else if currentRoom != nil {
+			currentRoom.Mutex.Lock()
+			// A player who already reconnected on another socket has not left.
+			// Every seat played from this connection goes offline with it.
+			seats := game.SeatsOn(currentRoom, ws)
+			for _, id := range seats {
+				p := currentRoom.Players[id]
 				p.Conn = nil
 				p.IsOnline = false // Mark player as offline
-				log.Printf("Player %s disconnected from room %s", p.Name, currentRoom.ID)
+				logger.Info("player disconnected", "player_name", p.Name)
 			}
-			currentRoom.Mutex.Unlock()
-			// State broadcast will trigger room list update if needed
-			if currentRoom != nil && currentRoom.Players[currentPlayerID] != nil {
+			if len(seats) > 0 {
+				// State broadcast will trigger room list update if needed
 				h.Manager.BroadcastState(currentRoom)
 			}
+			for _, id := range seats {
+				h.Manager.HandleDisconnect(currentRoom, id)
+			}
+			dropDecliner(currentRoom, currentPlayerID, ws)
+			currentRoom.Mutex.Unlock()
 		}
 		ws.Close()
+		game.ReleaseConn(ws)
 	}()
 
 	for {
 		var action model.Action
 		err := ws.ReadJSON(&action)
 		if err != nil {
+			logger.Debug("game connection closed", "err", err)
 			break
 		}
+		countAction(action.Type)
+		logger.Debug("action received", "action", action.Type, "value", action.Value)
 
 		if action.Type == "create_room" {
 			name := action.Payload
 			uid := h.Store.GetOrCreateUserID(name)
 			roomID := action.RoomID
 
-			h.Manager.RoomsLock.Lock()
-			if _, exists := h.Manager.Rooms[roomID]; exists {
-				h.Manager.RoomsLock.Unlock()
-				ws.WriteJSON(model.Message{Type: "error", Payload: "房间号已存在"})
+			if err := h.Manager.AddRoom(game.NewRoom(roomID, uid)); err != nil {
+				metrics.Errors.WithLabelValues(metrics.SourceClient).Inc()
+				logger.Info("room already exists", "room_id", roomID)
+				writeTo(logger, ws, model.Message{Type: "error", Payload: err.Error()})
 				continue
 			}
-			newRoom := &model.Room{
-				ID: roomID, OwnerID: uid, Players: make(map[string]*model.Player), Status: "waiting",
-			}
-			for i := 0; i < 4; i++ {
-				newRoom.Rows[i].Cards = make([]model.Card, 0)
-			}
-			h.Manager.Rooms[roomID] = newRoom
-			h.Store.PersistRoom(newRoom)
-			h.Manager.RoomsLock.Unlock()
+			logger.Info("room created", "room_id", roomID, "player_id", uid)
 
 			action.Type = "login"
 			action.ID = uid
@@ -121,75 +319,187 @@ func (h *Handler) HandleGameWS(w http.ResponseWriter, r *http.Request) {
 			uid := h.Store.GetOrCreateUserID(name)
 			roomID := action.RoomID
 
-			ws.WriteJSON(model.Message{Type: "identity", Payload: map[string]string{"id": uid, "name": name}})
+			writeTo(logger, ws, model.Message{Type: "identity", Payload: map[string]string{"id": uid, "name": name}})
 
 			h.Manager.RoomsLock.Lock()
 			room, exists := h.Manager.Rooms[roomID]
 			h.Manager.RoomsLock.Unlock()
 
 			if !exists {
-				ws.WriteJSON(model.Message{Type: "error", Payload: "房间不存在"})
+				metrics.Errors.WithLabelValues(metrics.SourceClient).Inc()
+				logger.Info("login to missing room", "room_id", roomID, "player_id", uid)
+				writeTo(logger, ws, model.Message{Type: "error", Payload: "房间不存在"})
+				continue
+			}
+
+			room.Mutex.Lock()
+			kicked := slices.Contains(room.Kicked, uid)
+			outsider := len(room.Entrants) > 0 && !slices.Contains(room.Entrants, uid)
+			room.Mutex.Unlock()
+			if kicked {
+				writeTo(logger, ws, model.Message{Type: "error", Payload: "你已被投票移出该房间，只能观战"})
+				continue
+			}
+
+			if outsider {
+				writeTo(logger, ws, model.Message{Type: "error", Payload: "这是锦标赛对局房间，只有本桌选手可以加入，其他人可以观战"})
 				continue
 			}
 
 			currentRoom = room
 			currentPlayerID = uid
+			spectating = false
+			logger = slog.With("request_id", requestID, "room_id", roomID, "player_id", uid)
+			logger.Info("player joined", "player_name", name)
 
 			room.Mutex.Lock()
+			dropDecliner(room, uid, ws)
 
 			if existingPlayer, ok := room.Players[uid]; ok {
 				existingPlayer.Conn = ws
 				existingPlayer.Name = name
 				existingPlayer.IsOnline = true // Mark player as online
-				room.Mutex.Unlock()
-				h.Manager.BroadcastState(room)
-				h.Manager.BroadcastStats(room)
+				existingPlayer.Host = ""       // A hot-seat guest logging in on their own device takes their seat back
+				h.Manager.HandleReturn(room, uid)
+				h.Manager.ReattachSeats(room, uid)
 			} else {
 				newPlayer := &model.Player{ID: uid, Name: name, Conn: ws, Score: 0, Ready: false, IsOnline: true}
 				room.Players[uid] = newPlayer
 				// OwnerID is set only on room creation, not on first player join.
-				room.Mutex.Unlock()
-				h.Manager.BroadcastState(room)
-				h.Manager.BroadcastStats(room)
 			}
+			game.QueueLateJoiner(room, uid)
+			h.Manager.ResumeAdjourned(room)
+			h.Manager.BroadcastState(room)
+			h.Manager.BroadcastStats(room)
+			h.Manager.SendChatHistory(room, uid, ws)
+			room.Mutex.Unlock()
 			go h.Manager.BroadcastRoomList() // Update lobby after login/reconnect
 
+		} else if action.Type == "spectate" {
+			name := action.Payload
+			uid := h.Store.GetOrCreateUserID(name)
+			roomID := action.RoomID
+
+			writeTo(logger, ws, model.Message{Type: "identity", Payload: map[string]string{"id": uid, "name": name}})
+
+			h.Manager.RoomsLock.Lock()
+			room, exists := h.Manager.Rooms[roomID]
+			h.Manager.RoomsLock.Unlock()
+
+			if !exists {
+				metrics.Errors.WithLabelValues(metrics.SourceClient).Inc()
+				writeTo(logger, ws, model.Message{Type: "error", Payload: "房间不存在"})
+				continue
+			}
+
+			currentRoom = room
+			currentPlayerID = uid
+			spectating = true
+			logger = slog.With("request_id", requestID, "room_id", roomID, "player_id", uid)
+			logger.Info("spectator joined", "player_name", name)
+
+			room.Mutex.Lock()
+			if room.Spectators == nil {
+				room.Spectators = make(map[string]*model.Spectator)
+			}
+			room.Spectators[uid] = &model.Spectator{ID: uid, Name: name, Conn: ws}
+			h.Manager.BroadcastState(room)
+			h.Manager.BroadcastStats(room)
+			h.Manager.SendChatHistory(room, uid, ws)
+			room.Mutex.Unlock()
+
+		} else if action.Type == "chat" || action.Type == "emote" {
+			if currentRoom != nil {
+				if spectating {
+					writeTo(logger, ws, model.Message{Type: "info", Payload: "观战者只能查看聊天"})
+					continue
+				}
+				currentRoom.Mutex.Lock()
+				err := h.Manager.HandleChat(currentRoom, currentPlayerID, action.Type, action.Payload)
+				currentRoom.Mutex.Unlock()
+				if err != nil {
+					writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+				}
+			}
+
+		} else if action.Type == "create_duplicate" {
+			// Handled outside the room lock: creating tables needs RoomsLock first.
+			if currentRoom != nil && !spectating {
+				seats, _ := strconv.Atoi(action.Payload)
+				if _, err := h.Manager.CreateDuplicate(currentRoom.ID, currentPlayerID, action.Value, seats); err != nil {
+					writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+				} else {
+					logger.Info("duplicate match created", "tables", action.Value, "seats", seats)
+				}
+			}
+
 		} else if action.Type == "delete_room" {
 			if currentRoom != nil {
+				// The match lock comes before the room lock, so look the match up first.
+				currentRoom.Mutex.Lock()
+				owner, duplicateID := currentRoom.OwnerID == currentPlayerID, currentRoom.DuplicateID
+				currentRoom.Mutex.Unlock()
+				if owner && duplicateID != "" && h.Manager.DuplicateInProgress(duplicateID) {
+					writeTo(logger, ws, model.Message{Type: "info", Payload: game.ErrDuplicateRunning.Error()})
+					continue
+				}
+
 				currentRoom.Mutex.Lock()
 				if currentRoom.OwnerID == currentPlayerID {
 					game.BroadcastInfo(currentRoom, "房主解散了房间")
 					for _, p := range currentRoom.Players {
 						if p.Conn != nil {
-							p.Conn.WriteJSON(model.Message{Type: "room_closed", Payload: ""})
+							writeTo(logger, p.Conn, model.Message{Type: "room_closed", Payload: ""})
 							p.Conn.Close()
 						}
 					}
+					for _, sp := range currentRoom.Spectators {
+						writeTo(logger, sp.Conn, model.Message{Type: "room_closed", Payload: ""})
+						sp.Conn.Close()
+					}
+					// Timers already waiting on the lock must leave the room alone.
+					currentRoom.Deleted = true
 					currentRoom.Mutex.Unlock()
 
 					h.Manager.RoomsLock.Lock()
 					delete(h.Manager.Rooms, currentRoom.ID)
 					h.Manager.RoomsLock.Unlock()
 					h.Store.DeleteRoom(currentRoom.ID)
+					logger.Info("room deleted by owner")
 
 					currentRoom = nil
 					go h.Manager.BroadcastRoomList()
+					go h.Manager.BroadcastSavedGames()
 					return
 				} else {
 					currentRoom.Mutex.Unlock()
-					ws.WriteJSON(model.Message{Type: "info", Payload: "只有房主可以解散房间"})
+					writeTo(logger, ws, model.Message{Type: "info", Payload: "只有房主可以解散房间"})
 				}
 			}
 
 		} else if action.Type == "leave_room" {
+			if currentRoom != nil && spectating {
+				currentRoom.Mutex.Lock()
+				delete(currentRoom.Spectators, currentPlayerID)
+				currentRoom.Mutex.Unlock()
+				currentRoom = nil
+				return
+			}
 			if currentRoom != nil {
 				currentRoom.Mutex.Lock()
-				if p, ok := currentRoom.Players[currentPlayerID]; ok {
+				seats := game.SeatsOn(currentRoom, ws)
+				for _, id := range seats {
+					p := currentRoom.Players[id]
 					p.Conn = nil
 					p.IsOnline = false // Mark player as offline, do not delete
-					game.BroadcastInfo(currentRoom, fmt.Sprintf("%s 离开了房间 (手牌已保留)", p.Name))
+					game.BroadcastInfo(currentRoom, fmt.Sprintf("%s 离开了房间", p.Name))
+					logger.Info("player left room", "player_name", p.Name)
 				}
 				h.Manager.BroadcastState(currentRoom) // Broadcast state to update online status
+				for _, id := range seats {
+					h.Manager.HandleDeparture(currentRoom, id)
+				}
+				dropDecliner(currentRoom, currentPlayerID, ws)
 				currentRoom.Mutex.Unlock()
 
 				currentRoom = nil // Avoid defer logic for this explicit leave
@@ -197,75 +507,72 @@ func (h *Handler) HandleGameWS(w http.ResponseWriter, r *http.Request) {
 			}
 		} else {
 			// Game logic
-			if currentRoom != nil && currentPlayerID != "" {
+			if currentRoom != nil && currentPlayerID != "" && !spectating {
 				currentRoom.Mutex.Lock()
 				player := currentRoom.Players[currentPlayerID]
-				if player != nil && player.IsOnline { // Only process actions from online players
+				seatID, seatErr := currentPlayerID, error(nil)
+				if player != nil && seatActions[action.Type] {
+					seatFor := game.SeatFor
+					if handActions[action.Type] {
+						seatFor = game.HandSeatFor
+					}
+					if seatID, seatErr = seatFor(currentRoom, currentPlayerID, action.ID); seatErr == nil {
+						player = currentRoom.Players[seatID]
+					}
+				}
+				if player != nil && player.IsOnline && (currentRoom.DuplicateID != "" || currentRoom.TournamentID != "") && scheduledLocked[action.Type] {
+					writeTo(logger, ws, model.Message{Type: "info", Payload: "复式比赛和锦标赛房间不能使用该操作"})
+				} else if seatErr != nil {
+					writeTo(logger, ws, model.Message{Type: "info", Payload: seatErr.Error()})
+				} else if player != nil && player.IsOnline { // Only process actions from online players
 					switch action.Type {
 					case "ready":
-						if currentRoom.Status == "waiting" {
-							player.Ready = true
-							// Ready logic for initial game start remains
-							readyCount := 0
-							for _, p := range currentRoom.Players {
-								if p.IsOnline && p.Ready {
-									readyCount++
-								}
+						if currentRoom.DuplicateID != "" {
+							// Every table of the match starts together; see StartDuplicateBoardIfReady.
+							if currentRoom.Status == "waiting" || currentRoom.Status == "finished" {
+								player.Ready = true
+								h.Manager.BroadcastState(currentRoom)
+								go h.Manager.StartDuplicateBoardIfReady(currentRoom.DuplicateID)
 							}
-							// Only start if at least two online players are ready
-							if readyCount >= 2 {
+						} else if player.SittingOut {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: "你正在暂停参赛，请先回到牌桌再准备"})
+						} else if currentRoom.Status == "waiting" {
+							player.Ready = true
+							// Two ready players start a normal room; tournament tables wait for every entrant.
+							if game.ReadyToStart(currentRoom) {
 								h.Manager.StartGame(currentRoom)
 							} else {
 								h.Manager.BroadcastState(currentRoom)
 							}
 						}
+					case "sit_out":
+						h.Manager.ToggleSitOut(currentRoom, seatID)
 					case "play_card":
-						if currentRoom.Status == "playing" && player.SelectedCard == nil {
-							valid := false
-							var selectC model.Card
-							for _, c := range player.Hand {
-								if c.Value == action.Value {
-									valid = true
-									selectC = c
-									break
-								}
-							}
-							if valid {
-								player.SelectedCard = &selectC
-								allSelected := true
-								// Only consider online players for allSelected check
-								for _, p := range currentRoom.Players {
-									if p.IsOnline && len(p.Hand) > 0 && p.SelectedCard == nil {
-										allSelected = false
-										break
-									}
-								}
-								if allSelected {
-									h.Manager.PrepareTurnResolution(currentRoom)
-								} else {
-									h.Manager.BroadcastState(currentRoom)
-								}
-							}
-						}
+						// Invalid plays are ignored; apply logs why they were rejected.
+						_ = h.Manager.PlayCard(currentRoom, seatID, action.Value)
 					case "choose_row":
-						if currentRoom.Status == "choosing_row" {
-							h.Manager.HandleRowChoice(currentRoom, currentPlayerID, action.Value)
-						}
+						_ = h.Manager.HandleRowChoice(currentRoom, seatID, action.Value)
 					case "force_restart": // New action for owner to force restart
 						if currentRoom.OwnerID == currentPlayerID {
 							if !h.Manager.ForceRestart(currentRoom, currentPlayerID) {
-								ws.WriteJSON(model.Message{Type: "info", Payload: "无法强制重开，可能人数不足或你不是房主"})
+								writeTo(logger, ws, model.Message{Type: "info", Payload: "无法强制重开，可能人数不足或你不是房主"})
 							}
 						} else {
-							ws.WriteJSON(model.Message{Type: "info", Payload: "只有房主可以强制重开"})
+							writeTo(logger, ws, model.Message{Type: "info", Payload: "只有房主可以强制重开"})
+						}
+					case "rematch":
+						if err := h.Manager.AnswerRematch(currentRoom, seatID, action.Payload == "yes"); err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
 						}
 					case "restart":
 						if currentRoom.Status == "finished" && currentRoom.OwnerID == currentPlayerID {
 							currentRoom.Status = "waiting"
+							game.EndSeries(currentRoom)
 							for _, p := range currentRoom.Players {
 								p.Ready = false
 								p.Score = 0
 								p.Hand = []model.Card{}
+								p.Pile = []model.Card{}
 								p.SelectedCard = nil
 							}
 							for i := 0; i < 4; i++ {
@@ -273,6 +580,79 @@ func (h *Handler) HandleGameWS(w http.ResponseWriter, r *http.Request) {
 							}
 							h.Manager.BroadcastState(currentRoom)
 						}
+					case "set_seed":
+						var seed *int64
+						if action.Payload != "" {
+							v, err := strconv.ParseInt(action.Payload, 10, 64)
+							if err != nil || v == 0 {
+								writeTo(logger, ws, model.Message{Type: "info", Payload: "种子必须是非零整数"})
+								break
+							}
+							seed = &v
+						}
+						if !h.Manager.SetNextSeed(currentRoom, currentPlayerID, seed) {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: "只有房主可以指定种子"})
+						}
+					case "client_seed":
+						if err := h.Manager.SetClientSeed(currentRoom, currentPlayerID, action.Payload); err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+						}
+					case "replay_deal":
+						if !h.Manager.ReplayDeal(currentRoom, currentPlayerID) {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: "无法重玩上一局，可能还没有结束的对局、人数不足或你不是房主"})
+						}
+					case "advise":
+						advice, err := h.Manager.Advise(currentRoom, seatID)
+						if err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+							break
+						}
+						writeTo(logger, ws, model.Message{Type: "advice", Payload: advice})
+					case "pause":
+						if err := h.Manager.OwnerPause(currentRoom, currentPlayerID); err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+						}
+					case "resume":
+						if err := h.Manager.OwnerResume(currentRoom, currentPlayerID); err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+						}
+					case "adjourn":
+						if err := h.Manager.OwnerAdjourn(currentRoom, currentPlayerID); err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+						}
+					case "vote_call":
+						// Payload is the kind of vote, ID the player a kick vote is about.
+						if err := h.Manager.CallVote(currentRoom, currentPlayerID, action.Payload, action.ID); err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+						}
+					case "vote":
+						if err := h.Manager.CastVote(currentRoom, seatID, action.Payload == "yes"); err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+						}
+					case "add_seat":
+						// Payload is the name of the player who sits down at this device.
+						name := strings.TrimSpace(action.Payload)
+						if name == "" {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: "请输入入座玩家的昵称"})
+							break
+						}
+						if err := h.Manager.AddSeat(currentRoom, currentPlayerID, h.Store.GetOrCreateUserID(name), name); err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+						}
+					case "switch_seat":
+						if err := h.Manager.SwitchSeat(currentRoom, currentPlayerID, action.ID); err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+						}
+					case "room_settings":
+						// Fields missing from the payload keep their current value.
+						settings := currentRoom.Settings
+						if err := json.Unmarshal([]byte(action.Payload), &settings); err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: "房间设置格式不正确"})
+							break
+						}
+						if err := h.Manager.UpdateSettings(currentRoom, currentPlayerID, settings); err != nil {
+							writeTo(logger, ws, model.Message{Type: "info", Payload: err.Error()})
+						}
 					}
 				}
 				currentRoom.Mutex.Unlock()
@@ -0,0 +1,1085 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"take5/internal/database"
+	"take5/internal/engine"
+	"take5/internal/game"
+	"take5/internal/logging"
+	"take5/internal/model"
+
+	"github.com/gorilla/websocket"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const waitTimeout = 10 * time.Second
+
+// testGrace keeps the departure grace period short enough for tests.
+const testGrace = 100 * time.Millisecond
+
+// testVoteTimeout lets an unanswered vote fail quickly.
+const testVoteTimeout = time.Second
+
+// testTurnDeadline is the turn deadline of correspondence games in tests.
+const testTurnDeadline = 2 * time.Second
+
+// testRematchWindow is how long players have to answer a rematch in tests.
+const testRematchWindow = 2 * time.Second
+
+// testNoShowWindow is how long tournament entrants have to turn up in tests.
+const testNoShowWindow = time.Second
+
+func TestMain(m *testing.M) {
+	if err := logging.Setup(io.Discard, "text", "error"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestServer serves the game endpoints from a fresh database.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	store, err := database.NewStore(filepath.Join(t.TempDir(), "take5.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := game.NewManager(store)
+	m.DepartureGrace = testGrace
+	m.VoteTimeout = testVoteTimeout
+	m.TurnDeadline = testTurnDeadline
+	m.RematchWindow = testRematchWindow
+	m.NoShowWindow = testNoShowWindow
+	h := NewHandler(m, store)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/check_room", h.CheckRoomHandler)
+	mux.HandleFunc("/verify_deal", h.VerifyDealHandler)
+	mux.HandleFunc("/lobby_ws", h.HandleLobbyWS)
+	mux.HandleFunc("/ws", h.HandleGameWS)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		srv.Close()
+		store.Close()
+	})
+	return srv
+}
+
+// seedWithRowChoice returns a seed whose deal to two players puts a card
+// below every row starter in someone's hand, so playing lowest cards first
+// makes the first turn ask for a row choice.
+func seedWithRowChoice(t *testing.T) int64 {
+	t.Helper()
+	for seed := int64(1); seed < 1000; seed++ {
+		r := &model.Room{}
+		game.InitDeck(r, engine.NewDealRNG(engine.ShuffleKey(seed, nil)))
+		lowest := engine.DeckSize
+		for _, c := range r.Deck[:2*engine.HandSize] {
+			lowest = min(lowest, c.Value)
+		}
+		starters := r.Deck[2*engine.HandSize : 2*engine.HandSize+engine.RowCount]
+		if lowest < min(starters[0].Value, starters[1].Value, starters[2].Value, starters[3].Value) {
+			return seed
+		}
+	}
+	t.Fatal("no seed with a row choice")
+	return 0
+}
+
+func TestFullGameWithRowChoice(t *testing.T) {
+	srv := newTestServer(t)
+	seed := seedWithRowChoice(t)
+
+	alice := dial(t, srv, "create_room", "alice", "full")
+	bob := dial(t, srv, "login", "bob", "full")
+	alice.send(model.Action{Type: "set_seed", Payload: strconv.FormatInt(seed, 10)})
+	alice.waitInfo("房主指定了下一局的发牌种子")
+
+	alice.autoplay(true)
+	bob.autoplay(true)
+	alice.send(model.Action{Type: "ready"})
+	bob.send(model.Action{Type: "ready"})
+
+	alice.waitInfo("太小了，请选择一行收走")
+	end := alice.waitState(func(s roomState) bool { return s.PublicState.Status == "finished" })
+	total := 0
+	for _, p := range end.PublicState.Players {
+		if p.HandSize != 0 {
+			t.Errorf("%s still holds %d cards", p.Name, p.HandSize)
+		}
+		if pile := engine.CalculateRowScore(model.Row{Cards: p.Pile}); pile != p.Score {
+			t.Errorf("%s scored %d but the pile holds %d bullheads", p.Name, p.Score, pile)
+		}
+		total += p.Score
+	}
+	if total == 0 {
+		t.Errorf("nobody took a row, want at least the chosen row")
+	}
+
+	// The finished deal is revealed and checks out against its commitments.
+	var verified struct {
+		Deal  model.DealRecord `json:"deal"`
+		Valid bool             `json:"valid"`
+	}
+	getJSON(t, srv.URL+"/verify_deal?room=full", &verified)
+	if !verified.Valid || verified.Deal.Seed != seed {
+		t.Errorf("verify_deal = %+v, want valid deal from seed %d", verified, seed)
+	}
+}
+
+func TestReconnectKeepsHand(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "recon")
+	bob := dial(t, srv, "login", "bob", "recon")
+	alice.send(model.Action{Type: "room_settings", Payload: `{"departure":"lowest"}`})
+	alice.waitInfo("自动出最小的牌")
+	alice.send(model.Action{Type: "ready"})
+	bob.send(model.Action{Type: "ready"})
+	dealt := bob.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+
+	bob.close()
+	hand := alice.waitState(func(s roomState) bool {
+		p, ok := s.PublicState.Players[bob.id]
+		return ok && !p.IsOnline
+	}).MyHand
+
+	// An offline player is not waited for: here their lowest card is played.
+	alice.send(model.Action{Type: "play_card", Value: hand[0].Value})
+	st := alice.waitState(func(s roomState) bool {
+		return s.PublicState.PendingPlayerID == alice.id || s.PublicState.Players[bob.id].HandSize == engine.HandSize-1
+	})
+	if st.PublicState.PendingPlayerID == alice.id {
+		alice.send(model.Action{Type: "choose_row", Value: 0})
+		alice.waitState(func(s roomState) bool { return s.PublicState.Players[bob.id].HandSize == engine.HandSize-1 })
+	}
+
+	bob = dial(t, srv, "login", "bob", "recon")
+	back := bob.waitState(func(s roomState) bool { return len(s.MyHand) > 0 })
+	if !sameCards(back.MyHand, dealt.MyHand[1:]) {
+		t.Errorf("hand after reconnect = %v, want %v", back.MyHand, dealt.MyHand[1:])
+	}
+	alice.waitState(func(s roomState) bool { return s.PublicState.Players[bob.id].IsOnline })
+}
+
+func TestDepartureForfeit(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "forfeit")
+	bob := dial(t, srv, "login", "bob", "forfeit")
+	carol := dial(t, srv, "login", "carol", "forfeit")
+	alice.send(model.Action{Type: "room_settings", Payload: `{"departure":"nope"}`})
+	alice.waitInfo("未知的离场处理方式")
+	alice.send(model.Action{Type: "room_settings", Payload: `{"departure":"forfeit"}`})
+	alice.waitInfo("弃权并作废手牌")
+
+	for _, c := range []*testClient{alice, bob, carol} {
+		c.autoplay(true)
+		c.send(model.Action{Type: "ready"})
+	}
+	carol.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+	carol.close()
+	alice.waitInfo("carol 弃权")
+
+	end := alice.waitState(func(s roomState) bool { return s.PublicState.Status == "finished" })
+	for _, p := range end.PublicState.Players {
+		if p.HandSize != 0 {
+			t.Errorf("%s still holds %d cards after the game", p.Name, p.HandSize)
+		}
+	}
+}
+
+func TestBotSubstitute(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "sub")
+	bob := dial(t, srv, "login", "bob", "sub")
+	// A bot stands in for players who drop out unless the room chose otherwise.
+	alice.send(model.Action{Type: "ready"})
+	bob.send(model.Action{Type: "ready"})
+	dealt := bob.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+
+	// Reconnecting within the grace period keeps the seat untouched.
+	bob.close()
+	bob = dial(t, srv, "login", "bob", "sub")
+	back := bob.waitState(func(s roomState) bool { return len(s.MyHand) > 0 })
+	time.Sleep(2 * testGrace)
+	if p := back.PublicState.Players[bob.id]; p.BotControlled || !sameCards(back.MyHand, dealt.MyHand) {
+		t.Fatalf("seat changed by a short disconnect: %+v, hand %v", p, back.MyHand)
+	}
+
+	bob.close()
+	alice.waitInfo("bob 在对局中离开")
+	st := alice.waitState(func(s roomState) bool { return s.PublicState.Players[bob.id].BotControlled })
+	alice.autoplay(true)
+	alice.send(model.Action{Type: "play_card", Value: st.MyHand[0].Value})
+	alice.waitState(func(s roomState) bool {
+		p := s.PublicState.Players[bob.id]
+		return p.BotAssisted && p.HandSize < engine.HandSize
+	})
+	alice.autoplay(false)
+
+	bob = dial(t, srv, "login", "bob", "sub")
+	alice.waitInfo("bob 回来了")
+	st = alice.waitState(func(s roomState) bool { return s.PublicState.Players[bob.id].IsOnline })
+	if p := st.PublicState.Players[bob.id]; p.BotControlled || !p.BotAssisted {
+		t.Errorf("after returning: %+v, want the seat back and the game still flagged", p)
+	}
+}
+
+func TestLateJoinerWaits(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "late")
+	bob := dial(t, srv, "login", "bob", "late")
+	alice.send(model.Action{Type: "ready"})
+	bob.send(model.Action{Type: "ready"})
+	dealt := alice.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+
+	carol := dial(t, srv, "login", "carol", "late")
+	carol.waitInfo("carol 加入了等候名单")
+	st := carol.waitState(func(s roomState) bool { return s.PublicState.Players[carol.id].Waiting })
+	if len(st.MyHand) != 0 {
+		t.Fatalf("late joiner holds %v mid-game", st.MyHand)
+	}
+
+	alice.autoplay(true)
+	bob.autoplay(true)
+	alice.send(model.Action{Type: "play_card", Value: dealt.MyHand[0].Value})
+	bob.send(model.Action{Type: "play_card", Value: bob.waitState(func(s roomState) bool { return len(s.MyHand) > 0 }).MyHand[0].Value})
+
+	var stats []model.PlayerStat
+	if err := json.Unmarshal(carol.waitType("stats").Payload, &stats); err != nil {
+		t.Fatal(err)
+	}
+	// The stats sent on login predate the game; skip to the ones after it.
+	for len(stats) == 0 {
+		if err := json.Unmarshal(carol.waitType("stats").Payload, &stats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, st := range stats {
+		if st.Name == "carol" {
+			t.Errorf("waiting player recorded in the results: %+v", st)
+		}
+	}
+
+	// The rematch seats carol.
+	alice.waitState(func(s roomState) bool { return s.PublicState.Rematch != nil })
+	alice.send(model.Action{Type: "rematch", Payload: "yes"})
+	bob.send(model.Action{Type: "rematch", Payload: "yes"})
+	carol.waitInfo("carol 从等候名单入座")
+	next := carol.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+	if p := next.PublicState.Players[carol.id]; p.Waiting || len(next.MyHand) != engine.HandSize {
+		t.Errorf("after the next deal: %+v with %d cards, want seated with a full hand", p, len(next.MyHand))
+	}
+}
+
+func TestSitOut(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "sitout")
+	bob := dial(t, srv, "login", "bob", "sitout")
+	carol := dial(t, srv, "login", "carol", "sitout")
+	carol.send(model.Action{Type: "sit_out"})
+	alice.waitInfo("carol 暂不参加")
+	carol.send(model.Action{Type: "ready"})
+	carol.waitInfo("你正在暂停参赛")
+
+	alice.send(model.Action{Type: "ready"})
+	bob.send(model.Action{Type: "ready"})
+	st := carol.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+	if p := st.PublicState.Players[carol.id]; !p.SittingOut || p.HandSize != 0 {
+		t.Errorf("sitting-out player dealt in: %+v", p)
+	}
+
+	carol.send(model.Action{Type: "sit_out"})
+	alice.waitInfo("carol 回到牌桌")
+	st = alice.waitState(func(s roomState) bool { return !s.PublicState.Players[carol.id].SittingOut })
+	if p := st.PublicState.Players[carol.id]; p.HandSize != 0 {
+		t.Errorf("opting back in mid-game dealt %d cards", p.HandSize)
+	}
+}
+
+func TestVotes(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "votes")
+	bob := dial(t, srv, "login", "bob", "votes")
+	carol := dial(t, srv, "login", "carol", "votes")
+	for _, c := range []*testClient{alice, bob, carol} {
+		c.send(model.Action{Type: "ready"})
+	}
+	dealt := alice.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+
+	bob.send(model.Action{Type: "vote_call", Payload: "pause"})
+	carol.waitInfo("bob 发起投票：暂停对局")
+	bob.send(model.Action{Type: "vote_call", Payload: "abort"})
+	bob.waitInfo("已经有一个投票在进行中")
+	carol.send(model.Action{Type: "vote", Payload: "yes"})
+	alice.waitInfo("投票通过：暂停对局")
+	alice.waitState(func(s roomState) bool { return s.PublicState.Status == "paused" && s.PublicState.Vote == nil })
+	alice.send(model.Action{Type: "play_card", Value: dealt.MyHand[0].Value})
+
+	bob.send(model.Action{Type: "vote_call", Payload: "resume"})
+	alice.waitInfo("发起投票：继续对局")
+	alice.send(model.Action{Type: "vote", Payload: "yes"})
+	st := alice.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+	if st.MySelectedCard != nil {
+		t.Errorf("card %d was played while paused", *st.MySelectedCard)
+	}
+
+	// Two of the three voters against a kick can never be outvoted.
+	bob.send(model.Action{Type: "vote_call", Payload: "kick", ID: alice.id})
+	carol.waitInfo("发起投票：踢出 alice")
+	carol.send(model.Action{Type: "vote", Payload: "no"})
+	bob.waitInfo("投票未通过：踢出 alice")
+
+	bob.send(model.Action{Type: "vote_call", Payload: "abort"})
+	bob.waitInfo("投票未通过：中止本局")
+
+	bob.send(model.Action{Type: "vote_call", Payload: "kick", ID: alice.id})
+	carol.waitInfo("发起投票：踢出 alice")
+	carol.send(model.Action{Type: "vote", Payload: "yes"})
+	alice.waitType("kicked")
+	bob.waitInfo("bob 成为新的房主")
+	st = bob.waitState(func(s roomState) bool { return s.PublicState.Players[alice.id].BotControlled })
+	if st.PublicState.OwnerID != bob.id {
+		t.Errorf("owner after kicking the owner = %q, want %q", st.PublicState.OwnerID, bob.id)
+	}
+
+	again := connect(t, srv)
+	again.send(model.Action{Type: "login", Payload: "alice", RoomID: "votes"})
+	again.waitType("error")
+}
+
+func TestPauseSuspendsDeparture(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "pause")
+	bob := dial(t, srv, "login", "bob", "pause")
+	alice.send(model.Action{Type: "ready"})
+	bob.send(model.Action{Type: "ready"})
+	bob.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+
+	bob.send(model.Action{Type: "pause"})
+	bob.waitInfo("只有房主可以直接暂停")
+	alice.send(model.Action{Type: "pause"})
+	alice.waitState(func(s roomState) bool { return s.PublicState.Status == "paused" })
+
+	// A disconnect while paused is not handed to the departure policy.
+	bob.close()
+	alice.waitState(func(s roomState) bool { return !s.PublicState.Players[bob.id].IsOnline })
+	time.Sleep(3 * testGrace)
+	alice.send(model.Action{Type: "resume"})
+	st := alice.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+	if p := st.PublicState.Players[bob.id]; p.BotControlled {
+		t.Fatalf("seat taken over during the pause: %+v", p)
+	}
+	alice.waitInfo("bob 在对局中离开")
+}
+
+func TestAdjourn(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "adjourn")
+	bob := dial(t, srv, "login", "bob", "adjourn")
+	alice.send(model.Action{Type: "ready"})
+	bob.send(model.Action{Type: "ready"})
+	dealt := bob.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+
+	bob.send(model.Action{Type: "adjourn"})
+	bob.waitInfo("只有房主可以直接休会")
+	alice.send(model.Action{Type: "adjourn"})
+	bob.waitState(func(s roomState) bool { return s.PublicState.Status == "adjourned" })
+
+	// Everyone may leave without the departure policy touching their seats.
+	alice.send(model.Action{Type: "leave_room"})
+	bob.close()
+	time.Sleep(3 * testGrace)
+
+	lobby := connectTo(t, srv, "/lobby_ws")
+	lobby.send(model.Action{Type: "hello", Payload: "bob"})
+	var games []model.SavedGame
+	lobby.wait("adjourned_games", func(m message) bool {
+		return m.Type == "adjourned_games" && json.Unmarshal(m.Payload, &games) == nil && len(games) > 0
+	})
+	if games[0].RoomID != "adjourn" || len(games[0].Participants) != 2 {
+		t.Fatalf("lobby lists %+v, want room adjourn with both players", games)
+	}
+
+	bob = dial(t, srv, "login", "bob", "adjourn")
+	st := bob.waitState(func(s roomState) bool { return len(s.MyHand) > 0 })
+	if st.PublicState.Status != "adjourned" || !sameCards(st.MyHand, dealt.MyHand) {
+		t.Fatalf("with alice still away: status %s, hand %v", st.PublicState.Status, st.MyHand)
+	}
+	alice = dial(t, srv, "login", "alice", "adjourn")
+	bob.waitInfo("对局继续")
+	st = bob.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+	if p := st.PublicState.Players[alice.id]; p.BotControlled || p.HandSize != engine.HandSize {
+		t.Errorf("alice after resuming: %+v", p)
+	}
+	lobby.wait("adjourned_games", func(m message) bool {
+		return m.Type == "adjourned_games" && json.Unmarshal(m.Payload, &games) == nil && len(games) == 0
+	})
+}
+
+func TestLobbyChat(t *testing.T) {
+	srv := newTestServer(t)
+	first := connectTo(t, srv, "/lobby_ws")
+	first.send(model.Action{Type: "hello", Payload: "alice"})
+	first.waitType("identity")
+	second := connectTo(t, srv, "/lobby_ws")
+	second.send(model.Action{Type: "hello", Payload: "alice"})
+	second.waitType("identity")
+
+	// A second connection shares the first one's rate limit.
+	for i := 0; i < 5; i++ {
+		first.send(model.Action{Type: "lobby_chat", Payload: strconv.Itoa(i)})
+		second.waitType("lobby_chat")
+	}
+	second.send(model.Action{Type: "lobby_chat", Payload: "again"})
+	second.waitInfo("发言太快了")
+
+	// Lobby chat lives under a reserved ID that no room may take.
+	c := connect(t, srv)
+	c.send(model.Action{Type: "create_room", Payload: "bob", RoomID: game.LobbyChatRoomID})
+	c.wait("error", func(m message) bool {
+		var text string
+		return m.Type == "error" && json.Unmarshal(m.Payload, &text) == nil && text == game.ErrRoomReserved.Error()
+	})
+	history := connectTo(t, srv, "/lobby_ws")
+	var msgs []model.ChatMessage
+	if err := json.Unmarshal(history.waitType("lobby_chat_history").Payload, &msgs); err != nil || len(msgs) != 5 {
+		t.Errorf("lobby history %v (%v), want the 5 messages sent", msgs, err)
+	}
+}
+
+func TestDuplicateTablesOutliveDelete(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "dup")
+	alice.send(model.Action{Type: "create_duplicate", Value: 2, Payload: "2"})
+	alice.waitInfo("复式比赛已创建")
+	alice.send(model.Action{Type: "delete_room"})
+	alice.waitInfo(game.ErrDuplicateRunning.Error())
+	for _, id := range []string{"dup", "dup-2"} {
+		var check map[string]bool
+		getJSON(t, srv.URL+"/check_room?id="+id, &check)
+		if !check["exists"] {
+			t.Errorf("table %s deleted during the match", id)
+		}
+	}
+}
+
+func TestTournamentNoShow(t *testing.T) {
+	srv := newTestServer(t)
+	lobbies := map[string]*testClient{}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		lobbies[name] = connectTo(t, srv, "/lobby_ws")
+		lobbies[name].send(model.Action{Type: "hello", Payload: name})
+		lobbies[name].waitType("identity")
+	}
+	organizer := lobbies["alice"]
+	organizer.send(model.Action{Type: "tournament_create", Payload: `{"name":"cup","format":"swiss","rounds":1,"tableSize":4}`})
+	var list []model.TournamentState
+	organizer.wait("tournaments", func(m message) bool {
+		return m.Type == "tournaments" && json.Unmarshal(m.Payload, &list) == nil && len(list) == 1
+	})
+	id := list[0].ID
+	for _, name := range []string{"alice", "bob", "carol"} {
+		lobbies[name].send(model.Action{Type: "tournament_join", ID: id})
+	}
+	organizer.wait("entrants", func(m message) bool {
+		return m.Type == "tournaments" && json.Unmarshal(m.Payload, &list) == nil && len(list[0].Entrants) == 3
+	})
+	organizer.send(model.Action{Type: "tournament_start", ID: id})
+	var invite model.Invite
+	organizer.wait("invite", func(m message) bool { return m.Type == "invite" && json.Unmarshal(m.Payload, &invite) == nil })
+
+	// Carol never turns up: once the deadline passes the others play without her.
+	alice := dial(t, srv, "login", "alice", invite.RoomID)
+	bob := dial(t, srv, "login", "bob", invite.RoomID)
+	alice.autoplay(true)
+	bob.autoplay(true)
+	alice.send(model.Action{Type: "ready"})
+	bob.waitInfo("1 名选手缺席，比赛开始")
+
+	organizer.wait("finished tournament", func(m message) bool {
+		return m.Type == "tournaments" && json.Unmarshal(m.Payload, &list) == nil && list[0].Status == "finished"
+	})
+	done := list[0]
+	table := done.History[0][0]
+	if !slices.Equal(table.NoShows, []string{entrantID(done, "carol")}) {
+		t.Fatalf("no-shows %v, want carol", table.NoShows)
+	}
+	worst := max(table.Scores[alice.id], table.Scores[bob.id])
+	for _, e := range done.Entrants {
+		if e.Name == "carol" && (e.Penalty != worst || e.Games != 0) {
+			t.Errorf("carol %+v, want the worst score %d and no games", e, worst)
+		}
+	}
+}
+
+// entrantID returns the ID of the entrant called name.
+func entrantID(s model.TournamentState, name string) string {
+	for _, e := range s.Entrants {
+		if e.Name == name {
+			return e.ID
+		}
+	}
+	return ""
+}
+
+func TestCorrespondence(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "mail")
+	bob := dial(t, srv, "login", "bob", "mail")
+	alice.send(model.Action{Type: "room_settings", Payload: `{"correspondence":true}`})
+	bob.waitInfo("房主开启了通信对局")
+	alice.send(model.Action{Type: "ready"})
+	bob.send(model.Action{Type: "ready"})
+	st := alice.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" && len(s.MyHand) > 0 })
+	alice.send(model.Action{Type: "room_settings", Payload: `{"correspondence":false}`})
+	alice.waitInfo("对局进行中不能切换通信对局模式")
+
+	lobby := connectTo(t, srv, "/lobby_ws")
+	lobby.send(model.Action{Type: "hello", Payload: "bob"})
+	var moves []model.YourMove
+	lobby.wait("your_move", func(m message) bool {
+		return m.Type == "your_move" && json.Unmarshal(m.Payload, &moves) == nil && len(moves) > 0
+	})
+	if moves[0].RoomID != "mail" || moves[0].Status != "playing" || moves[0].Deadline.IsZero() {
+		t.Fatalf("bob's moves: %+v", moves)
+	}
+
+	// Going offline does not hand the seat to the departure policy.
+	bob.close()
+	alice.send(model.Action{Type: "play_card", Payload: strconv.Itoa(st.MyHand[0].Value)})
+	time.Sleep(3 * testGrace)
+	bob = dial(t, srv, "login", "bob", "mail")
+	st = bob.waitState(func(s roomState) bool { return len(s.MyHand) > 0 })
+	if p := st.PublicState.Players[bob.id]; p.BotControlled || p.HandSize != engine.HandSize || st.MySelectedCard != nil {
+		t.Fatalf("bob after coming back: %+v", p)
+	}
+
+	// Nobody plays for him until the turn deadline passes.
+	bob.waitInfo("本回合已到截止时间")
+	st = bob.waitState(func(s roomState) bool { return len(s.MyHand) == engine.HandSize-1 })
+	if !st.PublicState.Players[bob.id].BotAssisted {
+		t.Errorf("bob's overdue move not marked as assisted")
+	}
+}
+
+func TestHotSeat(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "tablet")
+	alice.send(model.Action{Type: "add_seat", Payload: "bob"})
+	st := alice.waitState(func(s roomState) bool { return len(s.Seats) == 2 })
+	bobID := st.Seats[1]
+	if st.Seats[0] != alice.id || st.PublicState.Players[bobID].Host != alice.id {
+		t.Fatalf("seats %v, bob %+v", st.Seats, st.PublicState.Players[bobID])
+	}
+
+	alice.send(model.Action{Type: "ready"})
+	alice.send(model.Action{Type: "ready", ID: bobID})
+	// Each seat gets its own state, in no particular order.
+	var aliceView, bobView roomState
+	bobHidden := false
+	alice.waitState(func(s roomState) bool {
+		if s.PublicState.Status != "playing" {
+			return false
+		}
+		if s.Seat == alice.id && len(s.MyHand) > 0 {
+			aliceView = s
+		}
+		bobHidden = bobHidden || (s.Seat == bobID && s.Hidden && len(s.MyHand) == 0)
+		return aliceView.Seat != "" && bobHidden
+	})
+
+	// Handing the device over shows bob's hand and hides alice's.
+	alice.send(model.Action{Type: "switch_seat", ID: bobID})
+	aliceHidden := false
+	alice.waitState(func(s roomState) bool {
+		if s.ActiveSeat != bobID {
+			return false
+		}
+		if s.Seat == bobID && len(s.MyHand) > 0 {
+			bobView = s
+		}
+		aliceHidden = aliceHidden || (s.Seat == alice.id && s.Hidden)
+		return bobView.Seat != "" && aliceHidden
+	})
+
+	other := dial(t, srv, "login", "carol", "tablet")
+	other.send(model.Action{Type: "play_card", ID: bobID, Value: bobView.MyHand[0].Value})
+	other.waitInfo("这个座位不在你的设备上")
+
+	// Plays and advice only go to the seat the device is handed to.
+	alice.send(model.Action{Type: "advise", ID: alice.id})
+	alice.waitInfo("这个座位不在你的设备上")
+	alice.send(model.Action{Type: "play_card", ID: alice.id, Value: aliceView.MyHand[0].Value})
+	alice.waitInfo("这个座位不在你的设备上")
+	alice.send(model.Action{Type: "play_card", Value: bobView.MyHand[0].Value})
+	alice.send(model.Action{Type: "switch_seat", ID: alice.id})
+	alice.send(model.Action{Type: "play_card", ID: alice.id, Value: aliceView.MyHand[0].Value})
+	st = alice.waitState(func(s roomState) bool {
+		if s.PublicState.Status == "choosing_row" && s.Seat == s.PublicState.PendingPlayerID {
+			alice.send(model.Action{Type: "switch_seat", ID: s.PublicState.PendingPlayerID})
+			alice.send(model.Action{Type: "choose_row", Value: 0})
+		}
+		return s.PublicState.Status == "playing" && s.PublicState.Players[alice.id].HandSize == engine.HandSize-1 && s.PublicState.Players[bobID].HandSize == engine.HandSize-1
+	})
+	if sameCards(st.MyHand, bobView.MyHand) || sameCards(st.MyHand, aliceView.MyHand) {
+		t.Errorf("hands unchanged after both seats played")
+	}
+
+	// Bob takes his seat back on his own device.
+	bob := dial(t, srv, "login", "bob", "tablet")
+	st = bob.waitState(func(s roomState) bool { return len(s.MyHand) == engine.HandSize-1 })
+	if st.Seats != nil || st.PublicState.Players[bobID].Host != "" {
+		t.Errorf("bob still seated on alice's device: seats %v", st.Seats)
+	}
+	alice.waitState(func(s roomState) bool { return s.Seat == "" && len(s.MyHand) == engine.HandSize-1 })
+}
+
+func TestRematch(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "rematch")
+	bob := dial(t, srv, "login", "bob", "rematch")
+	carol := dial(t, srv, "login", "carol", "rematch")
+	players := []*testClient{alice, bob, carol}
+	for _, c := range players {
+		c.autoplay(true)
+		c.send(model.Action{Type: "ready"})
+	}
+
+	st := alice.waitState(func(s roomState) bool { return s.PublicState.Rematch != nil })
+	if len(st.PublicState.Rematch.Players) != 3 || st.PublicState.Series == nil || st.PublicState.Series.Games != 1 {
+		t.Fatalf("rematch offer %+v, series %+v", st.PublicState.Rematch, st.PublicState.Series)
+	}
+	carol.send(model.Action{Type: "rematch", Payload: "yes"})
+	carol.send(model.Action{Type: "rematch", Payload: "no"})
+	carol.waitInfo("你已经回应过了")
+
+	// Carol changes her mind too late; bob says no instead and watches the rematch.
+	first := st.PublicState.LastDeal.DealOrder
+	alice.send(model.Action{Type: "rematch", Payload: "yes"})
+	bob.send(model.Action{Type: "rematch", Payload: "no"})
+	alice.waitInfo("bob 改为观战")
+	st = bob.waitState(func(s roomState) bool { _, seated := s.PublicState.Players[bob.id]; return !seated })
+	if st.PublicState.Status != "playing" || len(st.MyHand) != 0 {
+		t.Fatalf("bob watching the rematch sees %q with %d cards", st.PublicState.Status, len(st.MyHand))
+	}
+
+	// The second game deals the two who stayed one seat on and extends the series.
+	st = alice.waitState(func(s roomState) bool { return s.PublicState.Rematch != nil })
+	want := []string{}
+	for _, id := range first {
+		if id != bob.id {
+			want = append(want, id)
+		}
+	}
+	want = append(want[1:], want[0])
+	if got := st.PublicState.LastDeal.DealOrder; !slices.Equal(got, want) {
+		t.Errorf("rematch dealt %v, want %v", got, want)
+	}
+	series := st.PublicState.Series
+	if series.Games != 2 || series.Totals[alice.id] < st.PublicState.Players[alice.id].Score || series.Names[bob.id] != "bob" {
+		t.Errorf("series after the rematch: %+v", series)
+	}
+
+	// Nobody takes it up: the room goes back to waiting, the series ends and
+	// the owner who declined hands the room to the player still seated.
+	alice.send(model.Action{Type: "rematch", Payload: "no"})
+	carol.waitInfo("carol 成为新的房主")
+	st = carol.waitState(func(s roomState) bool { return s.PublicState.Status == "waiting" })
+	if st.PublicState.Series != nil || st.PublicState.Rematch != nil {
+		t.Errorf("series survived going back to waiting: %+v", st.PublicState.Series)
+	}
+	if st.PublicState.OwnerID != carol.id || !st.PublicState.Players[carol.id].SittingOut {
+		t.Errorf("owner %q after alice declined, want carol sitting out the unanswered rematch", st.PublicState.OwnerID)
+	}
+}
+
+func TestReplayDealAfterRotation(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "replay")
+	bob := dial(t, srv, "login", "bob", "replay")
+	alice.send(model.Action{Type: "ready"})
+	bob.send(model.Action{Type: "ready"})
+	first := alice.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" && len(s.MyHand) > 0 })
+
+	// The rematch swaps the two seats; the replay must still deal alice her old hand.
+	alice.autoplay(true)
+	bob.autoplay(true)
+	alice.send(model.Action{Type: "play_card", Value: first.MyHand[0].Value})
+	bob.send(model.Action{Type: "play_card", Value: bob.waitState(func(s roomState) bool { return len(s.MyHand) > 0 }).MyHand[0].Value})
+	alice.waitState(func(s roomState) bool { return s.PublicState.Rematch != nil })
+	alice.autoplay(false)
+	bob.autoplay(false)
+	alice.send(model.Action{Type: "rematch", Payload: "yes"})
+	bob.send(model.Action{Type: "rematch", Payload: "yes"})
+	alice.waitInfo("再来一局！")
+
+	carol := dial(t, srv, "login", "carol", "replay")
+	carol.waitInfo("carol 加入了等候名单")
+	alice.send(model.Action{Type: "replay_deal"})
+	alice.waitInfo("选择重玩上一局的牌")
+	st := alice.waitState(func(s roomState) bool {
+		return s.PublicState.Status == "playing" && len(s.MyHand) == engine.HandSize && s.PublicState.Players[carol.id].Waiting
+	})
+	if !sameCards(st.MyHand, first.MyHand) {
+		t.Errorf("replayed hand %v, want %v", st.MyHand, first.MyHand)
+	}
+	if p := st.PublicState.Players[carol.id]; p.HandSize != 0 {
+		t.Errorf("carol dealt %d cards into a replay she did not play", p.HandSize)
+	}
+}
+
+func TestOwnerActions(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "owner")
+	bob := dial(t, srv, "login", "bob", "owner")
+
+	taken := connect(t, srv)
+	taken.send(model.Action{Type: "create_room", Payload: "carol", RoomID: "owner"})
+	taken.waitType("error")
+
+	missing := dial(t, srv, "login", "dave", "nowhere")
+	if got := missing.waitType("error"); !strings.Contains(string(got.Payload), "房间不存在") {
+		t.Errorf("login to missing room: %s", got.Payload)
+	}
+
+	bob.send(model.Action{Type: "force_restart"})
+	bob.waitInfo("只有房主可以强制重开")
+	bob.send(model.Action{Type: "set_seed", Payload: "7"})
+	bob.waitInfo("只有房主可以指定种子")
+	bob.send(model.Action{Type: "delete_room"})
+	bob.waitInfo("只有房主可以解散房间")
+
+	alice.send(model.Action{Type: "set_seed", Payload: "7"})
+	alice.waitState(func(s roomState) bool { return s.PublicState.SeedFixed })
+
+	alice.send(model.Action{Type: "force_restart"})
+	bob.waitInfo("强制重开了一局新游戏")
+	bob.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" })
+
+	alice.send(model.Action{Type: "delete_room"})
+	alice.waitType("room_closed")
+	bob.waitType("room_closed")
+	var check map[string]bool
+	getJSON(t, srv.URL+"/check_room?id=owner", &check)
+	if check["exists"] {
+		t.Errorf("room still exists after delete_room")
+	}
+}
+
+func TestAdviceAndSettings(t *testing.T) {
+	srv := newTestServer(t)
+	alice := dial(t, srv, "create_room", "alice", "advice")
+	bob := dial(t, srv, "login", "bob", "advice")
+
+	alice.send(model.Action{Type: "advise"})
+	alice.waitInfo("现在没有需要出的牌")
+
+	alice.send(model.Action{Type: "ready"})
+	bob.send(model.Action{Type: "ready"})
+	st := alice.waitState(func(s roomState) bool { return s.PublicState.Status == "playing" && len(s.MyHand) > 0 })
+	alice.send(model.Action{Type: "advise"})
+	var advice []model.CardAdvice
+	if err := json.Unmarshal(alice.waitType("advice").Payload, &advice); err != nil {
+		t.Fatal(err)
+	}
+	if len(advice) != len(st.MyHand) {
+		t.Fatalf("got advice for %d cards, hand has %d", len(advice), len(st.MyHand))
+	}
+	for i := 1; i < len(advice); i++ {
+		if advice[i].ExpectedPenalty < advice[i-1].ExpectedPenalty {
+			t.Errorf("advice not ranked by expected penalty: %+v", advice)
+		}
+	}
+
+	bob.send(model.Action{Type: "room_settings", Payload: `{"noAdvisor":true}`})
+	bob.waitInfo("只有房主可以修改房间设置")
+	alice.send(model.Action{Type: "room_settings", Payload: `{"noAdvisor":true}`})
+	bob.waitInfo("房主关闭了出牌提示")
+	bob.waitState(func(s roomState) bool { return s.PublicState.Settings.NoAdvisor })
+	bob.send(model.Action{Type: "advise"})
+	bob.waitInfo("本房间已关闭出牌提示")
+
+	if st.Unseen != nil {
+		t.Errorf("card tracker sent while off: %+v", st.Unseen)
+	}
+	alice.send(model.Action{Type: "room_settings", Payload: `{"cardTracker":true}`})
+	st = bob.waitState(func(s roomState) bool { return s.Unseen != nil })
+	// Bob has seen his own hand and the four row starters.
+	if want := engine.DeckSize - len(st.MyHand) - engine.RowCount; len(st.Unseen.Cards) != want {
+		t.Errorf("bob has %d unseen cards, want %d", len(st.Unseen.Cards), want)
+	}
+	if !st.PublicState.Settings.NoAdvisor {
+		t.Errorf("turning the tracker on reset the advisor setting")
+	}
+}
+
+// TestConcurrentPlayCard lets a full table submit cards at the same moment
+// every turn. Run with -race to check the room locking.
+func TestConcurrentPlayCard(t *testing.T) {
+	srv := newTestServer(t)
+	const players = 6
+	clients := []*testClient{dial(t, srv, "create_room", "p0", "race")}
+	for i := 1; i < players; i++ {
+		clients = append(clients, dial(t, srv, "login", "p"+strconv.Itoa(i), "race"))
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		c.autoplay(true)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.send(model.Action{Type: "ready"})
+		}()
+	}
+	wg.Wait()
+
+	// Poll the room from the side while cards are being played.
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if resp, err := http.Get(srv.URL + "/check_room?id=race"); err == nil {
+				resp.Body.Close()
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	defer close(done)
+
+	end := clients[0].waitState(func(s roomState) bool { return s.PublicState.Status == "finished" })
+	if len(end.PublicState.Players) != players {
+		t.Fatalf("players = %d, want %d", len(end.PublicState.Players), players)
+	}
+	cardsOnRows := 0
+	for _, r := range end.PublicState.Rows {
+		cardsOnRows += len(r.Cards)
+	}
+	if cardsOnRows < engine.RowCount {
+		t.Errorf("rows hold %d cards after the game", cardsOnRows)
+	}
+	for id, p := range end.PublicState.Players {
+		if p.HandSize != 0 {
+			t.Errorf("%s finished with %d cards", id, p.HandSize)
+		}
+	}
+}
+
+// roomState is the part of a "state" message the tests look at.
+type roomState struct {
+	PublicState struct {
+		Status          string                     `json:"status"`
+		Rows            [engine.RowCount]model.Row `json:"rows"`
+		PendingPlayerID string                     `json:"pendingPlayerId"`
+		SeedFixed       bool                       `json:"seedFixed"`
+		Settings        model.RoomSettings         `json:"settings"`
+		OwnerID         string                     `json:"ownerId"`
+		Vote            *model.Vote                `json:"vote"`
+		LastDeal        *model.DealRecord          `json:"lastDeal"`
+		Rematch         *model.Rematch             `json:"rematch"`
+		Series          *model.Series              `json:"series"`
+		Players         map[string]struct {
+			Name          string       `json:"name"`
+			Score         int          `json:"score"`
+			HandSize      int          `json:"handSize"`
+			IsOnline      bool         `json:"isOnline"`
+			BotControlled bool         `json:"botControlled"`
+			BotAssisted   bool         `json:"botAssisted"`
+			Waiting       bool         `json:"waiting"`
+			SittingOut    bool         `json:"sittingOut"`
+			HasSelected   bool         `json:"hasSelected"`
+			Host          string       `json:"host"`
+			Pile          []model.Card `json:"pile"`
+		} `json:"players"`
+	} `json:"publicState"`
+	MyHand         []model.Card      `json:"myHand"`
+	MySelectedCard *int              `json:"mySelectedCard"`
+	Unseen         *model.UnseenView `json:"unseen"`
+	Seat           string            `json:"seat"`
+	Seats          []string          `json:"seats"`
+	ActiveSeat     string            `json:"activeSeat"`
+	Hidden         bool              `json:"hidden"`
+}
+
+type message struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// testClient is a scripted game connection. Every message it receives is
+// queued for the test; with autoplay on it also plays its lowest card each
+// turn and takes the first row when asked.
+type testClient struct {
+	t    *testing.T
+	ws   *websocket.Conn
+	id   string
+	msgs chan message
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	auto    bool
+}
+
+// dial connects and joins room with create_room or login as name.
+func dial(t *testing.T, srv *httptest.Server, action, name, room string) *testClient {
+	t.Helper()
+	c := connect(t, srv)
+	c.send(model.Action{Type: action, Payload: name, RoomID: room})
+	var identity map[string]string
+	if err := json.Unmarshal(c.waitType("identity").Payload, &identity); err != nil {
+		t.Fatal(err)
+	}
+	c.id = identity["id"]
+	return c
+}
+
+func connect(t *testing.T, srv *httptest.Server) *testClient {
+	t.Helper()
+	return connectTo(t, srv, "/ws")
+}
+
+// connectTo opens a scripted connection to the websocket endpoint at path.
+func connectTo(t *testing.T, srv *httptest.Server, path string) *testClient {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testClient{t: t, ws: ws, msgs: make(chan message, 4096)}
+	t.Cleanup(c.close)
+	go c.read()
+	return c
+}
+
+func (c *testClient) read() {
+	defer close(c.msgs)
+	for {
+		var msg message
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		c.mu.Lock()
+		auto := c.auto
+		c.mu.Unlock()
+		if auto && msg.Type == "state" {
+			c.respond(msg)
+		}
+		c.msgs <- msg
+	}
+}
+
+// respond plays for the client. Repeated or stale actions are harmless:
+// the server ignores plays that are no longer valid.
+func (c *testClient) respond(msg message) {
+	var s roomState
+	if json.Unmarshal(msg.Payload, &s) != nil {
+		return
+	}
+	switch {
+	case s.PublicState.Status == "playing" && s.MySelectedCard == nil && len(s.MyHand) > 0:
+		c.send(model.Action{Type: "play_card", Value: s.MyHand[0].Value})
+	case s.PublicState.Status == "choosing_row" && s.PublicState.PendingPlayerID == c.id:
+		c.send(model.Action{Type: "choose_row", Value: 0})
+	}
+}
+
+func (c *testClient) autoplay(on bool) {
+	c.mu.Lock()
+	c.auto = on
+	c.mu.Unlock()
+}
+
+func (c *testClient) send(a model.Action) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	// Write errors surface as a missing reply in the wait helpers.
+	_ = c.ws.WriteJSON(a)
+}
+
+func (c *testClient) close() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.ws.Close()
+}
+
+// wait returns the first queued message matching match, failing the test
+// if none arrives in time.
+func (c *testClient) wait(what string, match func(message) bool) message {
+	c.t.Helper()
+	timeout := time.After(waitTimeout)
+	for {
+		select {
+		case msg, ok := <-c.msgs:
+			if !ok {
+				c.t.Fatalf("connection closed while waiting for %s", what)
+			}
+			if match(msg) {
+				return msg
+			}
+		case <-timeout:
+			c.t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func (c *testClient) waitType(typ string) message {
+	c.t.Helper()
+	return c.wait(typ, func(m message) bool { return m.Type == typ })
+}
+
+func (c *testClient) waitInfo(substr string) {
+	c.t.Helper()
+	c.wait("info "+substr, func(m message) bool {
+		var text string
+		return m.Type == "info" && json.Unmarshal(m.Payload, &text) == nil && strings.Contains(text, substr)
+	})
+}
+
+func (c *testClient) waitState(match func(roomState) bool) roomState {
+	c.t.Helper()
+	var s roomState
+	c.wait("state", func(m message) bool {
+		// Decode into a fresh value so fields a message leaves out read as zero.
+		s = roomState{}
+		return m.Type == "state" && json.Unmarshal(m.Payload, &s) == nil && match(s)
+	})
+	return s
+}
+
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sameCards(a, b []model.Card) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,247 @@
+// Package sim plays many games between bot strategies with the rules engine
+// and summarises how each strategy did.
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"take5/internal/bot"
+	"take5/internal/engine"
+)
+
+// winShares splits a win between tied players without rounding: 2520 is
+// divisible by every table size up to engine.MaxPlayers.
+const winShares = 2520
+
+// z95 is the normal quantile for two-sided 95% confidence intervals.
+const z95 = 1.96
+
+// Config describes a simulation run. Seats are filled with Strategies in
+// turn, rotating by one seat every game so no strategy keeps a seat.
+type Config struct {
+	Games      int
+	Players    int
+	Strategies []string
+	Seed       int64
+	Workers    int
+}
+
+// Report is the outcome of a run, one entry per strategy.
+type Report struct {
+	Games      int             `json:"games"`
+	Players    int             `json:"players"`
+	Seed       int64           `json:"seed"`
+	Strategies []StrategyStats `json:"strategies"`
+}
+
+// StrategyStats summarises every seat a strategy played. Rates are per game
+// played in one seat.
+type StrategyStats struct {
+	Strategy         string     `json:"strategy"`
+	Seats            int        `json:"seats"`
+	AvgBullheads     float64    `json:"avgBullheads"`
+	BullheadsCI95    [2]float64 `json:"bullheadsCi95"`
+	WinRate          float64    `json:"winRate"`
+	WinRateCI95      [2]float64 `json:"winRateCi95"`
+	RowsTakenPerGame float64    `json:"rowsTakenPerGame"`
+	OverflowsPerGame float64    `json:"overflowsPerGame"`
+	ChoicesPerGame   float64    `json:"choicesPerGame"`
+}
+
+// SeatResult is one player's result in one game.
+type SeatResult struct {
+	Bullheads int
+	WinShare  int // 胜局份额，单位为 1/winShares 局
+	Overflows int // 放第 6 张牌被迫收走的行数
+	Choices   int // 牌太小而自选收走的行数
+}
+
+// totals accumulates integer sums so the report does not depend on the
+// order games finish in.
+type totals struct {
+	seats, bullheads, squares, wins, overflows, choices int64
+}
+
+// Run plays cfg.Games games and reports per-strategy statistics. Game g is
+// dealt from seed cfg.Seed+g, so a run is reproducible whatever the number
+// of workers.
+func Run(cfg Config) (Report, error) {
+	if cfg.Games <= 0 {
+		return Report{}, errors.New("对局数必须大于 0")
+	}
+	if cfg.Players < 2 || cfg.Players > engine.MaxPlayers {
+		return Report{}, fmt.Errorf("玩家人数必须在 2 到 %d 之间", engine.MaxPlayers)
+	}
+	if len(cfg.Strategies) == 0 {
+		return Report{}, errors.New("至少需要一个策略")
+	}
+	for _, name := range cfg.Strategies {
+		if _, err := bot.New(name, nil); err != nil {
+			return Report{}, err
+		}
+	}
+	workers := max(cfg.Workers, 1)
+
+	sums := make(map[string]*totals, len(cfg.Strategies))
+	for _, name := range cfg.Strategies {
+		sums[name] = &totals{}
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var failed error
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range next {
+				seed := cfg.Seed + int64(g)
+				names := seatStrategies(cfg, g)
+				strategies := make([]bot.Strategy, len(names))
+				rng := rand.New(rand.NewPCG(uint64(seed), 0))
+				for i, name := range names {
+					strategies[i], _ = bot.New(name, rng)
+				}
+				results, err := PlayGame(seed, strategies)
+				mu.Lock()
+				if err != nil && failed == nil {
+					failed = err
+				}
+				for i, r := range results {
+					t := sums[names[i]]
+					t.seats++
+					t.bullheads += int64(r.Bullheads)
+					t.squares += int64(r.Bullheads * r.Bullheads)
+					t.wins += int64(r.WinShare)
+					t.overflows += int64(r.Overflows)
+					t.choices += int64(r.Choices)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for g := 0; g < cfg.Games; g++ {
+		next <- g
+	}
+	close(next)
+	wg.Wait()
+	if failed != nil {
+		return Report{}, failed
+	}
+
+	report := Report{Games: cfg.Games, Players: cfg.Players, Seed: cfg.Seed}
+	seen := map[string]bool{}
+	for _, name := range cfg.Strategies {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		report.Strategies = append(report.Strategies, sums[name].stats(name))
+	}
+	return report, nil
+}
+
+// seatStrategies returns the strategy names seated in game g.
+func seatStrategies(cfg Config, g int) []string {
+	names := make([]string, cfg.Players)
+	for i := range names {
+		names[i] = cfg.Strategies[(i+g)%len(cfg.Strategies)]
+	}
+	return names
+}
+
+// PlayGame plays one game between strategies, seat i being strategies[i],
+// with the deck a real table would deal from seed. A strategy that makes an
+// illegal move ends the game with an error.
+func PlayGame(seed int64, strategies []bot.Strategy) ([]SeatResult, error) {
+	ids := make([]string, len(strategies))
+	seat := make(map[string]int, len(strategies))
+	for i := range strategies {
+		ids[i] = fmt.Sprintf("p%d", i)
+		seat[ids[i]] = i
+	}
+	deck := engine.NewDeck()
+	engine.NewDealRNG(engine.ShuffleKey(seed, nil)).Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+
+	results := make([]SeatResult, len(strategies))
+	s, _, err := engine.Apply(engine.State{}, engine.Deal{Deck: deck, Players: ids})
+	for err == nil && s.Status != engine.StatusFinished {
+		var actions []engine.Action
+		if s.Status == engine.StatusChoosingRow {
+			id := s.PendingPlay.PlayerID
+			row := strategies[seat[id]].ChooseRow(bot.ViewOf(s, id), s.PendingPlay.Card)
+			actions = append(actions, engine.ChooseRow{PlayerID: id, Row: row})
+		} else {
+			// Everyone decides on the same view before any card is revealed.
+			for i, id := range ids {
+				if len(s.Hands[id]) > 0 {
+					actions = append(actions, engine.PlayCard{PlayerID: id, Value: strategies[i].PlayCard(bot.ViewOf(s, id))})
+				}
+			}
+		}
+		for _, a := range actions {
+			var events []engine.Event
+			if s, events, err = engine.Apply(s, a); err != nil {
+				break
+			}
+			for _, ev := range events {
+				if taken, ok := ev.(engine.RowTaken); ok {
+					if taken.Overflow {
+						results[seat[taken.PlayerID]].Overflows++
+					} else {
+						results[seat[taken.PlayerID]].Choices++
+					}
+				}
+			}
+		}
+	}
+	if err != nil {
+		// The engine refuses the move and the game cannot go on.
+		return nil, fmt.Errorf("种子 %d 的对局中策略做出了非法操作：%w", seed, err)
+	}
+
+	lowest, winners := -1, 0
+	for i, id := range ids {
+		results[i].Bullheads = s.Scores[id]
+		if lowest == -1 || s.Scores[id] < lowest {
+			lowest, winners = s.Scores[id], 0
+		}
+		if s.Scores[id] == lowest {
+			winners++
+		}
+	}
+	for i, id := range ids {
+		if s.Scores[id] == lowest {
+			results[i].WinShare = winShares / winners
+		}
+	}
+	return results, nil
+}
+
+func (t *totals) stats(name string) StrategyStats {
+	n := float64(t.seats)
+	st := StrategyStats{Strategy: name, Seats: int(t.seats)}
+	if t.seats == 0 {
+		return st
+	}
+	mean := float64(t.bullheads) / n
+	st.AvgBullheads = mean
+	if t.seats > 1 {
+		variance := (float64(t.squares) - n*mean*mean) / (n - 1)
+		half := z95 * math.Sqrt(math.Max(variance, 0)/n)
+		st.BullheadsCI95 = [2]float64{mean - half, mean + half}
+	} else {
+		st.BullheadsCI95 = [2]float64{mean, mean}
+	}
+	p := float64(t.wins) / winShares / n
+	half := z95 * math.Sqrt(p*(1-p)/n)
+	st.WinRate = p
+	st.WinRateCI95 = [2]float64{math.Max(p-half, 0), math.Min(p+half, 1)}
+	st.OverflowsPerGame = float64(t.overflows) / n
+	st.ChoicesPerGame = float64(t.choices) / n
+	st.RowsTakenPerGame = float64(t.overflows+t.choices) / n
+	return st
+}
@@ -0,0 +1,76 @@
+package sim
+
+import (
+	"math"
+	"reflect"
+	"take5/internal/bot"
+	"testing"
+)
+
+func TestRunIsReproducible(t *testing.T) {
+	cfg := Config{Games: 200, Players: 5, Strategies: []string{"greedy", "random", "lowest"}, Seed: 42, Workers: 1}
+	serial, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Workers = 8
+	parallel, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(serial, parallel) {
+		t.Errorf("results depend on the number of workers:\n%+v\n%+v", serial, parallel)
+	}
+}
+
+func TestRunAccountsForEverySeat(t *testing.T) {
+	cfg := Config{Games: 300, Players: 4, Strategies: []string{"greedy", "highest"}, Seed: 7, Workers: 4}
+	report, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seats, wins := 0, 0.0
+	for _, s := range report.Strategies {
+		seats += s.Seats
+		wins += s.WinRate * float64(s.Seats)
+		if s.BullheadsCI95[0] > s.AvgBullheads || s.BullheadsCI95[1] < s.AvgBullheads {
+			t.Errorf("%s: mean %.2f outside its interval %v", s.Strategy, s.AvgBullheads, s.BullheadsCI95)
+		}
+		if got := s.OverflowsPerGame + s.ChoicesPerGame; math.Abs(got-s.RowsTakenPerGame) > 1e-9 {
+			t.Errorf("%s: rows taken %.3f != overflows + choices %.3f", s.Strategy, s.RowsTakenPerGame, got)
+		}
+	}
+	if seats != cfg.Games*cfg.Players {
+		t.Errorf("seats = %d, want %d", seats, cfg.Games*cfg.Players)
+	}
+	// Exactly one win is shared out per game.
+	if math.Abs(wins-float64(cfg.Games)) > 1e-6 {
+		t.Errorf("wins = %.4f, want %d", wins, cfg.Games)
+	}
+}
+
+func TestRunRejectsBadConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{Games: 0, Players: 4, Strategies: []string{"greedy"}},
+		{Games: 1, Players: 1, Strategies: []string{"greedy"}},
+		{Games: 1, Players: 11, Strategies: []string{"greedy"}},
+		{Games: 1, Players: 4},
+		{Games: 1, Players: 4, Strategies: []string{"nope"}},
+	} {
+		if _, err := Run(cfg); err == nil {
+			t.Errorf("Run(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+// cheat plays a card it does not hold.
+type cheat struct{ bot.Strategy }
+
+func (cheat) PlayCard(bot.View) int { return 0 }
+
+func TestPlayGameReportsIllegalMoves(t *testing.T) {
+	greedy, _ := bot.New("greedy", nil)
+	if _, err := PlayGame(1, []bot.Strategy{greedy, cheat{greedy}}); err == nil {
+		t.Error("a strategy playing a card it does not hold went unnoticed")
+	}
+}
@@ -2,42 +2,88 @@ package main
 
 import (
 	"embed"
-	"fmt"
+	"flag"
 	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 	"take5/internal/database"
 	"take5/internal/game"
+	"take5/internal/logging"
 	"take5/internal/server"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 //go:embed static
 var content embed.FS
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		os.Exit(runSimulate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	janitor := game.DefaultJanitorConfig()
+	flag.DurationVar(&janitor.TTL, "room-ttl", janitor.TTL, "无人在线的房间空闲多久后被清理 (0 表示不清理)")
+	flag.DurationVar(&janitor.WarnBefore, "room-ttl-warn", janitor.WarnBefore, "清理前多久在大厅中提示")
+	flag.DurationVar(&janitor.Interval, "janitor-interval", janitor.Interval, "过期房间扫描间隔")
+	flag.BoolVar(&janitor.Archive, "archive-rooms", janitor.Archive, "归档而不是直接删除过期房间")
+	logFormat := flag.String("log-format", "text", "日志格式：text 或 json")
+	chatBlocklist := flag.String("chat-blocklist", "", "聊天屏蔽词，逗号分隔")
+	logLevel := flag.String("log-level", "info", "日志级别：debug、info、warn 或 error")
+	departureGrace := flag.Duration("departure-grace", game.DefaultDepartureGrace, "对局中断线的玩家多久未重连后由离场策略接管 (0 表示立即接管)")
+	voteTimeout := flag.Duration("vote-timeout", game.DefaultVoteTimeout, "房间投票的有效时间")
+	turnDeadline := flag.Duration("turn-deadline", game.DefaultTurnDeadline, "通信对局每回合等待出牌的最长时间")
+	rematchWindow := flag.Duration("rematch-window", game.DefaultRematchWindow, "对局结束后等待玩家回应再来一局的时间")
+	noShowWindow := flag.Duration("no-show-window", game.DefaultNoShowWindow, "锦标赛每桌等待选手到场的时间，到时缺席的选手按弃权处理")
+	flag.Parse()
+
+	if err := logging.Setup(os.Stderr, *logFormat, *logLevel); err != nil {
+		log.Fatal(err)
+	}
+
 	staticRoot, err := fs.Sub(content, "static")
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("failed to load static files", "err", err)
+		os.Exit(1)
 	}
 
 	store, err := database.NewStore("./take5.db")
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("failed to open database", "err", err)
+		os.Exit(1)
 	}
 	defer store.Close()
 
 	gameManager := game.NewManager(store)
+	gameManager.DepartureGrace = *departureGrace
+	gameManager.VoteTimeout = *voteTimeout
+	gameManager.TurnDeadline = *turnDeadline
+	gameManager.RematchWindow = *rematchWindow
+	gameManager.NoShowWindow = *noShowWindow
+	if *chatBlocklist != "" {
+		gameManager.Moderators = append(gameManager.Moderators, game.BlocklistModerator(strings.Split(*chatBlocklist, ",")))
+	}
 	gameManager.LoadRooms()
+	gameManager.StartJanitor(janitor)
 
 	handler := server.NewHandler(gameManager, store)
 
 	http.HandleFunc("/check_room", handler.CheckRoomHandler)
+	http.HandleFunc("/verify_deal", handler.VerifyDealHandler)
+	http.HandleFunc("/duplicate", handler.DuplicateHandler)
+	http.HandleFunc("/tournaments", handler.TournamentsHandler)
 	http.HandleFunc("/lobby_ws", handler.HandleLobbyWS)
 	http.HandleFunc("/ws", handler.HandleGameWS)
+	http.Handle("/metrics", promhttp.Handler())
 	http.Handle("/", http.FileServer(http.FS(staticRoot)))
 
-	fmt.Println("Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	slog.Info("server started", "addr", ":8080")
+	if err := http.ListenAndServe(":8080", nil); err != nil {
+		slog.Error("server stopped", "err", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,89 @@
+// static/js/fair.js
+// Browser side of the provably fair deal (see internal/game/fair.go).
+
+const encoder = new TextEncoder();
+
+async function sha256(bytes) {
+    return new Uint8Array(await crypto.subtle.digest("SHA-256", bytes));
+}
+
+function toHex(bytes) {
+    return Array.from(bytes, b => b.toString(16).padStart(2, "0")).join("");
+}
+
+export function isSupported() {
+    return !!(window.crypto && crypto.subtle);
+}
+
+export function randomClientSeed() {
+    const bytes = new Uint8Array(16);
+    crypto.getRandomValues(bytes);
+    return toHex(bytes);
+}
+
+// seed is the decimal string sent by the server.
+export async function seedCommit(seed) {
+    return toHex(await sha256(encoder.encode(seed)));
+}
+
+export async function deckCommit(seed, deck) {
+    return toHex(await sha256(encoder.encode(seed + ":" + deck.join(","))));
+}
+
+async function shuffleKey(seed, clientSeeds) {
+    let s = seed;
+    for (const id of Object.keys(clientSeeds || {}).sort()) {
+        s += `|${id}=${clientSeeds[id]}`;
+    }
+    return sha256(encoder.encode(s));
+}
+
+// Same stream as DealRNG: block n is sha256(key || uint32be(n)).
+async function shuffledDeck(seed, clientSeeds) {
+    const key = await shuffleKey(seed, clientSeeds);
+    let counter = 0;
+    let words = [];
+    const next = async () => {
+        if (words.length === 0) {
+            const block = new Uint8Array(36);
+            block.set(key);
+            new DataView(block.buffer).setUint32(32, counter++);
+            const view = new DataView((await sha256(block)).buffer);
+            for (let i = 0; i < 32; i += 4) words.push(view.getUint32(i));
+        }
+        return words.shift();
+    };
+    const intn = async (n) => {
+        const limit = 2 ** 32 - (2 ** 32) % n;
+        for (;;) {
+            const v = await next();
+            if (v < limit) return v % n;
+        }
+    };
+    const deck = [];
+    for (let i = 1; i <= 104; i++) deck.push(i);
+    for (let i = deck.length - 1; i > 0; i--) {
+        const j = await intn(i + 1);
+        [deck[i], deck[j]] = [deck[j], deck[i]];
+    }
+    return deck;
+}
+
+// verifyDeal checks a revealed deal against what this client saw at the
+// start of the game. Returns a list of failed checks (empty means fair).
+export async function verifyDeal(deal, seen, myId) {
+    const problems = [];
+    if (await seedCommit(deal.seed) !== deal.seedCommit) problems.push("种子与开局前公布的承诺不符");
+    if (seen.seedCommit && seen.seedCommit !== deal.seedCommit) problems.push("开局种子承诺被更换");
+    const deck = await shuffledDeck(deal.seed, deal.clientSeeds);
+    if (deck.join(",") !== (deal.deck || []).join(",")) problems.push("牌序无法由种子重算");
+    if (await deckCommit(deal.seed, deal.deck || []) !== deal.deckCommit) problems.push("牌序与承诺不符");
+    if (seen.deckCommit && seen.deckCommit !== deal.deckCommit) problems.push("牌序承诺被更换");
+    if (seen.clientSeed && (deal.clientSeeds || {})[myId] !== seen.clientSeed) problems.push("我的客户端种子未被采用");
+    const idx = (deal.dealOrder || []).indexOf(myId);
+    if (seen.hand && idx >= 0) {
+        const dealt = deck.slice(idx * 10, idx * 10 + 10).sort((a, b) => a - b).join(",");
+        if (dealt !== [...seen.hand].sort((a, b) => a - b).join(",")) problems.push("我的手牌与牌序不符");
+    }
+    return problems;
+}
@@ -1,10 +1,17 @@
 // static/js/main.js
 
-import { connectLobby, connectGame, sendAction, closeGame, closeLobby } from './network.js';
+import { connectLobby, connectGame, sendAction, sendLobbyAction, closeGame } from './network.js';
 import * as UI from './ui.js';
 import * as State from './state.js';
+import * as Fair from './fair.js';
 
 let lastPendingLogKey = "";
+// Provably fair bookkeeping: the client seed sent for each commitment,
+// what we observed when the current deal started, and verified deals.
+const sentClientSeeds = {};
+let dealSeen = null;
+const dealChecks = {};
+let lastDuplicatePlayed = 0;
 
 window.onload = function() {
     // Restore session
@@ -19,6 +26,8 @@ window.onload = function() {
     const urlParams = new URLSearchParams(window.location.search);
     const roomParam = urlParams.get('room');
 
+    // The lobby socket stays open in-game so presence and invitations keep working.
+    connectLobby(window.location.protocol, window.location.host);
     if (roomParam) {
         document.getElementById("new-room-id").value = roomParam;
         if (State.getMyName()) {
@@ -26,8 +35,6 @@ window.onload = function() {
         } else {
             alert("请先输入昵称");
         }
-    } else {
-        connectLobby(window.location.protocol, window.location.host);
     }
 
     // Bind Global Events
@@ -38,13 +45,44 @@ window.onload = function() {
     window.sendReady = sendReady;
     window.sendRestart = sendRestart;
     window.sendForceRestart = sendForceRestart;
+    window.sendSetSeed = sendSetSeed;
+    window.sendReplayDeal = sendReplayDeal;
+    window.requestAdvice = requestAdvice;
+    window.toggleAdvisor = toggleAdvisor;
+    window.toggleTracker = toggleTracker;
+    window.setDeparture = setDeparture;
+    window.toggleCorrespondence = toggleCorrespondence;
+    window.toggleSitOut = toggleSitOut;
+    window.callVote = callVote;
+    window.togglePause = togglePause;
+    window.addSeat = addSeat;
+    window.switchSeat = switchSeat;
+    window.sendAdjourn = sendAdjourn;
+    window.castVote = castVote;
+    window.answerRematch = answerRematch;
     window.confirmPlay = confirmPlay;
     window.showStats = showStats;
     window.closeStats = closeStats;
     window.copyInviteLink = copyInviteLink;
+    window.sendChat = sendChat;
+    window.sendEmote = sendEmote;
+    window.sendLobbyChat = sendLobbyChat;
+    window.showInvite = showInvite;
+    window.createDuplicate = createDuplicate;
+    window.createTournament = createTournament;
+    window.showDuplicate = showDuplicate;
+    window.closeDuplicate = closeDuplicate;
+    window.closeInvite = closeInvite;
 
     // Listen for custom events from UI module
     window.addEventListener('join-room', (e) => joinRoom(e.detail));
+    window.addEventListener('spectate-room', (e) => spectateRoom(e.detail));
+    document.getElementById("chat-input").addEventListener("keydown", (e) => {
+        if (e.key === "Enter") sendChat();
+    });
+    document.getElementById("lobby-chat-input").addEventListener("keydown", (e) => {
+        if (e.key === "Enter") sendLobbyChat();
+    });
     document.getElementById("close-game-over-btn").addEventListener("click", UI.closeGameOver);
     document.getElementById("game-over-modal").addEventListener("click", function (e) {
         if (e.target === this) UI.closeGameOver();   // 点背景也关闭
@@ -57,6 +95,7 @@ function saveUserInfo() {
     const nameInput = document.getElementById("username-input");
     const name = nameInput.value.trim();
     if (!name) { alert("请输入昵称"); return false; }
+    if (name !== State.getMyName()) sendLobbyAction({ type: "hello", payload: name });
     State.setIdentity(State.getMyId(), name);
     return true;
 }
@@ -85,6 +124,11 @@ async function joinRoom(roomId) {
     }
 }
 
+function spectateRoom(roomId) {
+    if (!saveUserInfo()) return;
+    connectGame(window.location.protocol, window.location.host, roomId, "spectate", State.getMyId(), State.getMyName());
+}
+
 export function leaveRoom(passive = false) {
     if (!passive) {
         sendAction({ type: "leave_room" });
@@ -102,7 +146,115 @@ function deleteRoom() {
     }
 }
 
+function sendChat() {
+    const input = document.getElementById("chat-input");
+    const text = input.value.trim();
+    if (!text) return;
+    sendAction({type: "chat", payload: text});
+    input.value = "";
+}
+function sendEmote(key) { sendAction({type: "emote", payload: key}); }
+
+// ensureLobbyIdentity says hello on the lobby socket the first time a name
+// is needed there. Returns false if no name has been entered.
+function ensureLobbyIdentity() {
+    if (State.getMyName()) return true;
+    if (!saveUserInfo()) return false;
+    sendLobbyAction({ type: "hello", payload: State.getMyName() });
+    return true;
+}
+
+function sendLobbyChat() {
+    const input = document.getElementById("lobby-chat-input");
+    const text = input.value.trim();
+    if (!text) return;
+    if (!ensureLobbyIdentity()) return;
+    sendLobbyAction({ type: "lobby_chat", payload: text });
+    input.value = "";
+}
+
+function createTournament() {
+    if (!ensureLobbyIdentity()) return;
+    const name = prompt("锦标赛名称：", "周赛");
+    if (!name) return;
+    const knockout = confirm("选择赛制：确定 = 淘汰制（每桌前一半晋级），取消 = 瑞士制（按累计牛头数分桌）");
+    const tableSize = parseInt(prompt("每桌人数（2-10）：", "4"), 10);
+    if (!tableSize) return;
+    let rounds = 0;
+    if (!knockout) {
+        rounds = parseInt(prompt("瑞士制轮数（1-10）：", "3"), 10);
+        if (!rounds) return;
+    }
+    const cfg = { name: name.trim(), format: knockout ? "knockout" : "swiss", rounds, tableSize };
+    sendLobbyAction({ type: "tournament_create", payload: JSON.stringify(cfg) });
+}
+
+export function handleAdjourned(list) {
+    UI.renderAdjourned(list, joinRoom);
+}
+
+export function handleYourMoves(list) {
+    UI.renderYourMoves(list, joinRoom);
+}
+
+// handleTournaments re-renders the lobby tournament panel.
+export function handleTournaments(list) {
+    UI.renderTournaments(list, State.getMyId(), (type, id) => {
+        if (type === "enter") {
+            joinRoom(id);
+            return;
+        }
+        if (!ensureLobbyIdentity()) return;
+        sendLobbyAction({ type, id });
+    });
+}
+
+function showInvite() {
+    document.getElementById("invite-modal").style.display = "flex";
+    UI.renderInviteList(State.getPresence(), State.getCurrentRoomId(), (targetId) => {
+        sendLobbyAction({ type: "invite", id: targetId, roomId: State.getCurrentRoomId() });
+    });
+}
+function closeInvite() {
+    document.getElementById("invite-modal").style.display = "none";
+}
+
+// handleInvite follows the same ?room= link that copyInviteLink shares.
+export function handleInvite(invite) {
+    if (invite.roomId === State.getCurrentRoomId()) return;
+    if (confirm(`${invite.fromName} 邀请你加入房间 ${invite.roomId}，是否加入？`)) {
+        const url = new URL(window.location.origin);
+        url.searchParams.set('room', invite.roomId);
+        window.location.href = url.toString();
+    }
+}
+
 function sendReady() { sendAction({type: "ready"}); }
+function toggleSitOut() { sendAction({type: "sit_out"}); }
+// callVote takes a vote-select value: a vote kind, or "kick:<playerId>".
+function callVote(value) {
+    document.getElementById("vote-select").value = "";
+    if (!value) return;
+    const [kind, target] = value.split(":");
+    sendAction({type: "vote_call", payload: kind, id: target || ""});
+}
+function addSeat() {
+    const name = prompt("同屏加座：输入在这台设备上一起玩的玩家昵称", "");
+    if (!name || !name.trim()) return;
+    sendAction({type: "add_seat", payload: name.trim()});
+}
+function switchSeat(id) { sendAction({type: "switch_seat", id: id}); }
+function togglePause() {
+    const status = State.getCurrentGameState()?.publicState?.status;
+    sendAction({type: status === "paused" ? "resume" : "pause"});
+}
+function sendAdjourn() {
+    if (confirm("确定要休会吗？对局会被保存，所有参与者回到房间后自动继续。")) {
+        sendAction({type: "adjourn"});
+    }
+}
+function castVote(yes) { sendAction({type: "vote", payload: yes ? "yes" : "no"}); }
+function answerRematch(yes) { sendAction({type: "rematch", payload: yes ? "yes" : "no"}); }
 function sendRestart() { sendAction({type: "restart"}); }
 function sendForceRestart() {
     if (confirm("确定要强制重开一局新游戏吗？本局将被作废。")) {
@@ -110,6 +262,88 @@ function sendForceRestart() {
     }
 }
 
+function sendSetSeed() {
+    const seed = prompt("输入下一局的发牌种子（非零整数，留空恢复随机）：", "");
+    if (seed === null) return;
+    sendAction({type: "set_seed", payload: seed.trim()});
+}
+function requestAdvice() { sendAction({type: "advise"}); }
+function toggleAdvisor() {
+    const settings = State.getCurrentGameState()?.publicState?.settings || {};
+    sendAction({type: "room_settings", payload: JSON.stringify({noAdvisor: !settings.noAdvisor})});
+}
+function toggleTracker() {
+    const settings = State.getCurrentGameState()?.publicState?.settings || {};
+    sendAction({type: "room_settings", payload: JSON.stringify({cardTracker: !settings.cardTracker})});
+}
+function toggleCorrespondence() {
+    const settings = State.getCurrentGameState()?.publicState?.settings || {};
+    sendAction({type: "room_settings", payload: JSON.stringify({correspondence: !settings.correspondence})});
+}
+function setDeparture(policy) {
+    sendAction({type: "room_settings", payload: JSON.stringify({departure: policy})});
+}
+// renderVoteSelect offers the votes that make sense in the current status,
+// plus a kick vote for every other player. Scheduled rooms have no votes.
+function renderVoteSelect(publicState, status, me) {
+    const select = document.getElementById("vote-select");
+    const running = status === "playing" || status === "choosing_row";
+    select.style.display = (me.id && !me.waiting && !me.sittingOut && !publicState.vote && !publicState.duplicate && !publicState.tournament) ? "inline-block" : "none";
+    const options = [["", "🗳️ 发起投票…"], ["restart", "重开一局"]];
+    if (running) options.push(["pause", "暂停对局"]);
+    if (status === "paused") options.push(["resume", "继续对局"]);
+    if (running || status === "paused") options.push(["adjourn", "休会"]);
+    if (running || status === "paused" || status === "adjourned") options.push(["abort", "中止本局"]);
+    Object.values(publicState.players).forEach(p => {
+        if (p.id !== me.id) options.push([`kick:${p.id}`, `踢出 ${p.name}`]);
+    });
+    select.innerHTML = options.map(([v, t]) => `<option value="${v}">${t}</option>`).join("");
+}
+
+// handleAdvice shows the server's ranking for the hand it was asked about.
+export function handleAdvice(advice) {
+    adviceHandSize = (State.getCurrentGameState()?.myHand || []).length;
+    UI.renderAdvice(advice);
+}
+// adviceHandSize is the hand size the shown advice was computed for; the
+// panel is cleared once a card has been played from that hand.
+let adviceHandSize = null;
+function createDuplicate() {
+    const tables = parseInt(prompt("复式比赛：一共几桌？（2-8，当前房间为第 1 桌）", "2"), 10);
+    if (!tables) return;
+    const seats = prompt("每桌几人？（2-10，将进行同样副数的比赛，每人轮流坐遍每个座位）", "4");
+    if (!seats) return;
+    sendAction({type: "create_duplicate", value: tables, payload: seats.trim()});
+}
+function showDuplicate() {
+    const dup = State.getCurrentGameState()?.publicState?.duplicate;
+    if (!dup) return;
+    fetch(`/duplicate?id=${encodeURIComponent(dup.id)}`)
+        .then(res => res.json())
+        .then(board => {
+            if (board.error) { log(board.error); return; }
+            UI.renderDuplicate(board);
+            document.getElementById("duplicate-modal").style.display = "flex";
+        });
+}
+function closeDuplicate() {
+    document.getElementById("duplicate-modal").style.display = "none";
+}
+// handleDuplicateScoreboard shows the scoreboard whenever a board is complete.
+export function handleDuplicateScoreboard(board) {
+    UI.renderDuplicate(board);
+    const modal = document.getElementById("duplicate-modal");
+    if (board.played !== lastDuplicatePlayed) {
+        lastDuplicatePlayed = board.played;
+        modal.style.display = "flex";
+    }
+}
+function sendReplayDeal() {
+    if (confirm("确定要用上一局完全相同的牌重新开一局吗？当前对局将被作废。")) {
+        sendAction({type: "replay_deal"});
+    }
+}
+
 export function confirmPlay() {
     const val = State.getMySelectedCardValue();
     if (val === null) return;
@@ -151,17 +385,17 @@ function closeStats() {
 // --- Logic & Rendering Wiring ---
 
 export function handleStateUpdate(msg) {
-    if (msg.type === "auto_restart_countdown") {
-        // 如果结算画面没显示，先显示
-        if (!State.getGameOverShown() && State.getCurrentGameState()?.publicState?.status === "finished") {
-            UI.renderGameOver(State.getCurrentGameState().publicState.players, State.getMyId());
-            State.setGameOverShown(true);
-        }
-        UI.updateCountdownDisplay(msg.payload.count);
-        return;
-    } else if (msg.type === "state") {
+    if (msg.type === "state") {
         const payload = msg.payload;
-        // 处理自动重启的状态重置
+        // A device holding several seats gets a state per seat; only the
+        // seat it is handed to carries a hand.
+        if (payload.hidden) return;
+        if (State.setSeat(payload.seat || "")) {
+            State.setMySelectedCardValue(null);
+            State.setMyConfirmPending(false);
+        }
+        UI.renderSeats(payload.seats, payload.activeSeat, payload.publicState.players);
+        // 再来一局开始后关闭结算
         if (State.getGameOverShown() && payload.publicState.status === "playing") {
             UI.closeGameOver();
             State.setGameOverShown(false);
@@ -182,11 +416,12 @@ export function handleStateUpdate(msg) {
             const url = new URL(window.location);
             url.searchParams.set('room', payload.roomId);
             window.history.pushState({}, '', url);
-            closeLobby();
         }
 
         State.setCurrentGameState(payload);
         State.setCurrentRoomId(payload.roomId);
+        State.setSpectator(!!payload.spectator);
+        UI.setSpectatorMode(State.isSpectator());
         
         const publicState = payload.publicState;
         const myHand = payload.myHand || [];
@@ -205,7 +440,7 @@ export function handleStateUpdate(msg) {
         if (!iHaveSelected && status === "playing") {
              State.setMyConfirmPending(false);
         }
-        if (status !== "playing" && status !== "choosing_row") {
+        if (status !== "playing" && status !== "choosing_row" && status !== "paused" && status !== "adjourned") {
             State.setMyConfirmPending(false);
             State.setMySelectedCardValue(null);
         }
@@ -225,7 +460,45 @@ export function handleStateUpdate(msg) {
         
             // Check for offline players for force restart button visibility
             const hasOffline = Object.values(publicState.players).some(p => !p.isOnline);
-            document.getElementById("force-restart-btn").style.display = (isOwnerVal && status === "playing" && hasOffline) ? "inline-block" : "none";
+            // Duplicate tables share their deals, so per-room restarts and seeds are off.
+            const duplicate = publicState.duplicate;
+            document.getElementById("force-restart-btn").style.display = (isOwnerVal && !duplicate && status === "playing" && hasOffline) ? "inline-block" : "none";
+            document.getElementById("seed-btn").style.display = (isOwnerVal && !duplicate && (status === "waiting" || status === "finished")) ? "inline-block" : "none";
+            document.getElementById("seed-btn").innerText = publicState.seedFixed ? "🎲 已指定种子" : "🎲 指定种子";
+            document.getElementById("replay-deal-btn").style.display = (isOwnerVal && !duplicate && publicState.lastDeal) ? "inline-block" : "none";
+            document.getElementById("duplicate-btn").style.display = (isOwnerVal && !duplicate && status === "waiting") ? "inline-block" : "none";
+            document.getElementById("duplicate-board-btn").style.display = duplicate ? "inline-block" : "none";
+            const sitOutBtn = document.getElementById("sit-out-btn");
+            sitOutBtn.style.display = (me.id && !duplicate && !publicState.tournament) ? "inline-block" : "none";
+            sitOutBtn.innerText = me.sittingOut ? "🪑 回到牌桌" : "☕ 暂停参赛";
+            document.getElementById("add-seat-btn").style.display = (me.id && !me.host && !duplicate && !publicState.tournament) ? "inline-block" : "none";
+            const pauseBtn = document.getElementById("pause-btn");
+            pauseBtn.style.display = (isOwnerVal && !duplicate && !publicState.tournament && (status === "playing" || status === "choosing_row" || status === "paused")) ? "inline-block" : "none";
+            pauseBtn.innerText = status === "paused" ? "▶️ 继续" : "⏸️ 暂停";
+            document.getElementById("adjourn-btn").style.display = (isOwnerVal && !duplicate && !publicState.tournament && (status === "playing" || status === "choosing_row" || status === "paused")) ? "inline-block" : "none";
+            UI.renderVote(publicState.vote, publicState.players, State.getMyId());
+            UI.renderRematch(publicState.rematch, publicState.players, State.getMyId());
+            UI.renderSeries(publicState.series);
+            renderVoteSelect(publicState, status, me);
+            // Scheduled rooms refuse setting changes; tournament tables never offer hints.
+            const settings = publicState.settings || {};
+            const canAdvise = !settings.noAdvisor && status === "playing" && !iHaveSelected && myHand.length > 0;
+            document.getElementById("advise-btn").style.display = canAdvise ? "inline-block" : "none";
+            document.getElementById("advisor-toggle-btn").style.display = (isOwnerVal && !duplicate && !publicState.tournament && status !== "playing" && status !== "choosing_row") ? "inline-block" : "none";
+            document.getElementById("advisor-toggle-btn").innerText = settings.noAdvisor ? "💡 开启提示" : "💡 关闭提示";
+            document.getElementById("tracker-toggle-btn").style.display = document.getElementById("advisor-toggle-btn").style.display;
+            document.getElementById("tracker-toggle-btn").innerText = settings.cardTracker ? "🔢 关闭记牌器" : "🔢 开启记牌器";
+            document.getElementById("correspondence-toggle-btn").style.display = (isOwnerVal && !duplicate && !publicState.tournament && status === "waiting") ? "inline-block" : "none";
+            document.getElementById("correspondence-toggle-btn").innerText = settings.correspondence ? "📮 关闭通信对局" : "📮 开启通信对局";
+            UI.renderTracker(payload.unseen, myHand);
+            const departureSelect = document.getElementById("departure-select");
+            departureSelect.style.display = document.getElementById("advisor-toggle-btn").style.display;
+            departureSelect.value = settings.departure || "bot";
+            if (!canAdvise || myHand.length !== adviceHandSize) {
+                adviceHandSize = null;
+                UI.renderAdvice(null);
+            }
+            trackFairDeal(payload, myHand);
         
                     UI.renderPlayers(publicState.players, publicState.pendingPlayerId, publicState.ownerId);
         
@@ -337,7 +610,7 @@ export function handleStateUpdate(msg) {
         }
     }
     
-    UI.updateInstructions(status, publicState, State.getMyId(), msg.type === "auto_restart_countdown" ? msg.payload.Count : null);
+    UI.updateInstructions(status, publicState, State.getMyId());
 }
 }
 
@@ -411,3 +684,46 @@ function findLandingRow(landingMap, val) {
     landingMap.forEach((cards, idx) => { if (cards.some(c => c.value === val)) hit = idx; });
     return hit;
 }
+
+// trackFairDeal contributes a client seed to every new commitment, remembers
+// what the server committed to when a deal starts and verifies the revealed
+// deal once the game is over.
+function trackFairDeal(payload, myHand) {
+    const publicState = payload.publicState;
+    if (!Fair.isSupported()) {
+        UI.renderSeed(publicState.lastDeal, null);
+        return;
+    }
+    if (!State.isSpectator() && publicState.seedCommit && !sentClientSeeds[publicState.seedCommit]) {
+        sentClientSeeds[publicState.seedCommit] = Fair.randomClientSeed();
+        sendAction({type: "client_seed", payload: sentClientSeeds[publicState.seedCommit]});
+    }
+    if (publicState.status === "playing" && publicState.deckCommit && (!dealSeen || dealSeen.deckCommit !== publicState.deckCommit) && myHand.length === 10) {
+        // Replays reuse an earlier seed, so only hold the server to the
+        // commitment we contributed to when it is the one being dealt.
+        const ours = sentClientSeeds[publicState.dealSeedCommit];
+        dealSeen = {
+            deckCommit: publicState.deckCommit,
+            seedCommit: ours ? publicState.dealSeedCommit : null,
+            clientSeed: ours || null,
+            hand: myHand.map(c => c.value),
+        };
+    }
+    const deal = publicState.lastDeal;
+    if (!deal) {
+        UI.renderSeed(null, null);
+        return;
+    }
+    if (dealChecks[deal.deckCommit] === undefined) {
+        dealChecks[deal.deckCommit] = null;
+        const seen = dealSeen && dealSeen.deckCommit === deal.deckCommit ? dealSeen : {};
+        Fair.verifyDeal(deal, seen, State.getMyId()).then(problems => {
+            dealChecks[deal.deckCommit] = problems;
+            const cur = State.getCurrentGameState();
+            if (cur && cur.publicState.lastDeal && cur.publicState.lastDeal.deckCommit === deal.deckCommit) {
+                UI.renderSeed(deal, problems);
+            }
+        });
+    }
+    UI.renderSeed(deal, dealChecks[deal.deckCommit]);
+}
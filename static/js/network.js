@@ -12,12 +12,49 @@ export function connectLobby(protocol, host) {
         scheme = "ws://"
     }
     lobbyWs = new WebSocket(scheme + host + "/lobby_ws");
+    lobbyWs.onopen = () => {
+        import('./state.js').then(module => {
+            if (module.getMyName()) sendLobbyAction({ type: "hello", payload: module.getMyName() });
+        });
+    };
     lobbyWs.onmessage = (evt) => {
         const msg = JSON.parse(evt.data);
         if (msg.type === "room_list") {
             renderRoomList(msg.payload);
+        } else if (msg.type === "identity") {
+            import('./state.js').then(module => {
+                module.setIdentity(msg.payload.id, msg.payload.name);
+            });
+        } else if (msg.type === "presence") {
+            import('./state.js').then(module => module.setPresence(msg.payload || []));
+            import('./ui.js').then(module => module.renderPresence(msg.payload || []));
+        } else if (msg.type === "lobby_chat_history") {
+            import('./ui.js').then(module => module.renderLobbyChatHistory(msg.payload));
+        } else if (msg.type === "lobby_chat") {
+            import('./ui.js').then(module => module.appendLobbyChat(msg.payload));
+        } else if (msg.type === "invite") {
+            import('./main.js').then(module => module.handleInvite(msg.payload));
+        } else if (msg.type === "your_move") {
+            import('./main.js').then(module => module.handleYourMoves(msg.payload || []));
+        } else if (msg.type === "adjourned_games") {
+            import('./main.js').then(module => module.handleAdjourned(msg.payload || []));
+        } else if (msg.type === "tournaments") {
+            import('./main.js').then(module => module.handleTournaments(msg.payload || []));
+        } else if (msg.type === "info") {
+            import('./ui.js').then(module => module.lobbyNotice(msg.payload));
         }
     };
+    lobbyWs.onclose = () => {
+        lobbyWs = null;
+    };
+}
+
+export function sendLobbyAction(action) {
+    if (lobbyWs && lobbyWs.readyState === WebSocket.OPEN) {
+        lobbyWs.send(JSON.stringify(action));
+    } else {
+        console.error("Lobby WebSocket is not open");
+    }
 }
 
 export function connectGame(protocol, host, roomId, actionType, myId, myName) {
@@ -49,10 +86,18 @@ export function connectGame(protocol, host, roomId, actionType, myId, myName) {
             alert(msg.payload);
             gameWs.close();
             gameWs = null;
-        } else if (msg.type === "state" || msg.type === "auto_restart_countdown") {
+        } else if (msg.type === "state") {
             handleStateUpdate(msg);
         } else if (msg.type === "info") {
             log(msg.payload);
+        } else if (msg.type === "chat_history") {
+            import('./ui.js').then(module => {
+                module.renderChatHistory(msg.payload);
+            });
+        } else if (msg.type === "chat") {
+            import('./ui.js').then(module => {
+                module.appendChat(msg.payload);
+            });
         } else if (msg.type === "stats") {
             import('./state.js').then(module => {
                 module.setRoomStats(msg.payload || []);
@@ -61,6 +106,15 @@ export function connectGame(protocol, host, roomId, actionType, myId, myName) {
             import('./ui.js').then(module => {
                 module.renderStats();
             });
+        } else if (msg.type === "advice") {
+            import('./main.js').then(module => module.handleAdvice(msg.payload || []));
+        } else if (msg.type === "duplicate_scoreboard") {
+            import('./main.js').then(module => module.handleDuplicateScoreboard(msg.payload));
+        } else if (msg.type === "kicked") {
+            alert(msg.payload);
+            import('./main.js').then(module => {
+                module.leaveRoom(true);
+            });
         } else if (msg.type === "room_closed") {
             alert("房间已解散");
             import('./main.js').then(module => {
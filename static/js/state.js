@@ -11,8 +11,13 @@ let lastSubmittedCardRect = null;
 let prevRowsSnapshot = null;
 let prevPlayersSnapshot = null;
 let gameOverShown = false;
+let spectator = false;
+let presence = [];
+let seatId = ""; // 同屏模式下设备当前交给的座位，空表示自己
 
-export function getMyId() { return myId; }
+// getMyId is the seat the game screen is shown for: the seat the device is
+// handed to in hot-seat play, the logged-in player otherwise.
+export function getMyId() { return seatId || myId; }
 export function getMyName() { return myName; }
 export function getCurrentRoomId() { return currentRoomId; }
 export function getCurrentGameState() { return currentGameState; }
@@ -44,4 +49,18 @@ export function isOwner() {
 }
 
 export function setGameOverShown(shown) { gameOverShown = shown; }
-export function getGameOverShown() { return gameOverShown; }
\ No newline at end of file
+export function getGameOverShown() { return gameOverShown; }
+export function setSpectator(val) { spectator = val; }
+export function isSpectator() { return spectator; }
+
+// setSeat records the seat a state message is for and reports whether the
+// device changed hands.
+export function setSeat(id) {
+    const next = id === myId ? "" : id;
+    const changed = next !== seatId;
+    seatId = next;
+    return changed;
+}
+
+export function setPresence(list) { presence = list; }
+export function getPresence() { return presence; }
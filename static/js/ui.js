@@ -14,12 +14,22 @@ export function renderRoomList(rooms) {
         div.innerHTML = `
             <div class="room-info">
                 <strong>房间 ${r.id}</strong> <span style="color:#666">(${r.ownerName})</span>
+                ${r.duplicate ? `<span class="room-expiry">🪑 复式 ${r.duplicate}</span>` : ''}
+                ${r.correspondence ? `<span class="room-expiry">📮 通信对局</span>` : ''}
                 <br>人数: ${r.playerCount}
+                ${r.expiresAt ? `<br><span class="room-expiry">⏳ 长时间无人活动，将于 ${new Date(r.expiresAt * 1000).toLocaleString()} 清理</span>` : ''}
+            </div>
+            <div class="room-actions">
+                <div class="room-status ${r.status}">${r.status === 'waiting' ? '等待中' : r.status === 'paused' ? '已暂停' : r.status === 'adjourned' ? '休会中' : '游戏中'}</div>
+                <button class="btn-small btn-blue spectate-btn">👀 观战</button>
             </div>
-            <div class="room-status ${r.status}">${r.status === 'waiting' ? '等待中' : '游戏中'}</div>
         `;
         // We need to call a function in main.js to handle join logic
         div.onclick = () => window.dispatchEvent(new CustomEvent('join-room', { detail: r.id }));
+        div.querySelector(".spectate-btn").onclick = (e) => {
+            e.stopPropagation();
+            window.dispatchEvent(new CustomEvent('spectate-room', { detail: r.id }));
+        };
         container.appendChild(div);
     });
 }
@@ -32,9 +42,15 @@ export function renderPlayers(players, pendingPid, ownerId) {
     const myId = getMyId();
     Object.values(players).forEach(p => {
         const div = document.createElement("div");
-        div.className = `player-tag ${p.id === myId ? 'me' : ''} ${p.ready ? 'ready' : ''} ${p.id === ownerId ? 'owner' : ''} ${p.isOnline ? 'online' : 'offline'}`;
+        div.className = `player-tag ${p.id === myId ? 'me' : ''} ${p.ready ? 'ready' : ''} ${p.id === ownerId ? 'owner' : ''} ${p.isOnline ? 'online' : 'offline'} ${p.botControlled ? 'bot' : ''} ${p.waiting ? 'waiting' : ''} ${p.sittingOut ? 'sitting-out' : ''} ${p.host ? 'hot-seat' : ''}`;
         div.dataset.uid = p.id; 
-        div.innerText = `${p.name} (${p.score})`;
+        div.innerText = `${p.botControlled ? '🤖 ' : ''}${p.waiting ? '⏳ ' : ''}${p.name} ${p.waiting ? '(下一局)' : `(${p.score})`}`;
+        if (p.botControlled) div.title = "已离开，由机器人代打";
+        if (p.waiting) div.title = "在等候名单中，下一局开始时入座";
+        if (p.sittingOut) {
+            div.innerText = `☕ ${div.innerText}`;
+            div.title = "暂停参赛，接下来的对局不发牌";
+        }
         container.appendChild(div);
     });
 }
@@ -94,19 +110,16 @@ export function renderBoard(rows, status, pendingPid, predictedRow, landingMap,
     return animationTargets;
 }
 
-export function updateInstructions(status, publicState, myId, countdownValue = null) {
+export function updateInstructions(status, publicState, myId) {
     const instruction = document.getElementById("instruction");
     const readyBtn = document.getElementById("ready-btn");
-    
-    if (status === "countdown" && countdownValue !== null) {
-        instruction.style.display = "block";
-        instruction.style.background = "#e67e22"; // Orange for countdown
-        instruction.innerHTML = `新一局游戏将在 <strong>${countdownValue}</strong> 秒后开始...`;
-        readyBtn.style.display = "none"; // Hide ready button during countdown
-        return;
-    }
 
-    if (status === "waiting") {
+    if (status === "waiting" && publicState.players[myId] && publicState.players[myId].sittingOut) {
+        readyBtn.style.display = "none";
+        instruction.style.display = "block";
+        instruction.style.background = "#7f8c8d";
+        instruction.innerText = "你正在暂停参赛，点击“回到牌桌”后才能准备";
+    } else if (status === "waiting") {
         readyBtn.style.display = "inline-block";
         const meReady = publicState.players[myId];
         readyBtn.innerText = (meReady && meReady.ready) ? "等待其他人..." : "准备 / Ready";
@@ -114,7 +127,24 @@ export function updateInstructions(status, publicState, myId, countdownValue = n
         instruction.style.display = "none";
     } else {
         readyBtn.style.display = "none";
-        if (status === "choosing_row") {
+        const me = publicState.players[myId];
+        if (me && me.waiting && (status === "playing" || status === "choosing_row" || status === "paused")) {
+            instruction.style.display = "block";
+            instruction.style.background = "#7f8c8d";
+            instruction.innerText = "本局已经开始，你在等候名单中，下一局开始时入座";
+        } else if (status === "adjourned") {
+            const missing = (publicState.participants || []).filter(id => !publicState.players[id] || !publicState.players[id].isOnline)
+                .map(id => publicState.players[id] ? publicState.players[id].name : id);
+            instruction.style.display = "block";
+            instruction.style.background = "#34495e";
+            instruction.innerText = missing.length > 0
+                ? `🛏️ 对局已休会，等待 ${missing.join("、")} 回到房间后自动继续`
+                : "🛏️ 对局已休会";
+        } else if (status === "paused") {
+            instruction.style.display = "block";
+            instruction.style.background = "#34495e";
+            instruction.innerText = "⏸️ 对局已暂停，房主或投票可以继续";
+        } else if (status === "choosing_row") {
             instruction.style.display = "block";
             if (publicState.pendingPlayerId === myId) {
                 instruction.style.background = "#e74c3c";
@@ -123,6 +153,10 @@ export function updateInstructions(status, publicState, myId, countdownValue = n
                 instruction.style.background = "#d35400";
                 instruction.innerText = `等待某人选行...`;
             }
+        } else if (status === "playing" && publicState.turnDeadline) {
+            instruction.style.display = "block";
+            instruction.style.background = "#16a085";
+            instruction.innerText = `📮 通信对局：本回合 ${new Date(publicState.turnDeadline).toLocaleString()} 截止，到时未出牌的自动出最小的牌`;
         } else {
             instruction.style.display = "none";
         }
@@ -144,6 +178,130 @@ export function renderPredictionMessage(idx) {
     else el.innerText = `预计将放入第 ${idx + 1} 行`;
 }
 
+// renderAdvice lists the advisor's ranking, safest card first; null hides it.
+export function renderAdvice(advice) {
+    const el = document.getElementById("advice-panel");
+    if (!el) return;
+    if (!advice || advice.length === 0) {
+        el.style.display = "none";
+        el.innerHTML = "";
+        return;
+    }
+    const rows = advice.map((a, i) => {
+        const where = a.undercut ? "比所有行都小" : `第 ${a.row + 1} 行`;
+        return `<tr class="${i === 0 ? "advice-best" : ""}"><td>${a.card}</td><td>${where}</td><td>${Math.round(a.takeChance * 100)}%</td><td>${a.expectedPenalty.toFixed(1)}</td></tr>`;
+    }).join("");
+    el.innerHTML = `<table><tr><th>牌</th><th>落点</th><th>收行概率</th><th>预计牛头</th></tr>${rows}</table>`;
+    el.style.display = "block";
+}
+
+const VOTE_TEXT = { kick: "踢出", restart: "重开一局", abort: "中止本局", pause: "暂停对局", resume: "继续对局", adjourn: "休会" };
+
+// renderSeats shows the seats held by this device in hot-seat play, with the
+// one it is handed to highlighted; it is hidden for a single seat.
+export function renderSeats(seats, activeSeat, players) {
+    const bar = document.getElementById("seat-bar");
+    bar.innerHTML = "";
+    bar.style.display = seats && seats.length > 1 ? "block" : "none";
+    (seats || []).forEach(id => {
+        const p = players[id] || {};
+        const btn = document.createElement("button");
+        btn.className = `btn-small ${id === activeSeat ? "btn-green" : "btn-blue"}`;
+        btn.innerText = `${id === activeSeat ? "📱 " : ""}${p.name || id}${p.hasSelected ? " ✅" : ""}`;
+        btn.title = id === activeSeat ? "设备当前在这位玩家手中" : "把设备交给这位玩家";
+        btn.onclick = () => window.switchSeat(id);
+        bar.appendChild(btn);
+    });
+}
+
+// renderVote shows the vote in progress with its tally, and yes/no buttons
+// for a voter who has not voted yet. No vote hides the panel.
+export function renderVote(vote, players, myId) {
+    const el = document.getElementById("vote-panel");
+    if (!el) return;
+    if (!vote) {
+        el.style.display = "none";
+        el.innerHTML = "";
+        return;
+    }
+    const name = id => (players[id] && players[id].name) || "已离开的玩家";
+    const what = vote.kind === "kick" ? `${VOTE_TEXT.kick} ${name(vote.target)}` : VOTE_TEXT[vote.kind];
+    const left = Math.max(0, Math.round((new Date(vote.deadline) - Date.now()) / 1000));
+    const canVote = vote.voters.includes(myId) && !vote.yes.includes(myId) && !vote.no.includes(myId);
+    el.innerHTML = `🗳️ ${name(vote.callerId)} 发起投票：<strong>${what}</strong>
+        （赞成 ${vote.yes.length} / 反对 ${vote.no.length} / 共 ${vote.voters.length} 人，约 ${left} 秒后截止）
+        ${canVote ? '<button class="btn-green" onclick="castVote(true)">赞成</button> <button class="btn-red" onclick="castVote(false)">反对</button>' : ''}`;
+    el.style.display = "block";
+}
+
+// renderRematch shows who has answered the rematch offer, and accept or
+// decline buttons for a player of the last game who has not answered yet.
+// No offer hides the panel.
+export function renderRematch(rematch, players, myId) {
+    const el = document.getElementById("rematch-panel");
+    if (!el) return;
+    if (!rematch) {
+        el.style.display = "none";
+        el.innerHTML = "";
+        return;
+    }
+    const name = id => (players[id] && players[id].name) || "已离开的玩家";
+    const left = Math.max(0, Math.round((new Date(rematch.deadline) - Date.now()) / 1000));
+    const canAnswer = rematch.players.includes(myId) && !rematch.accepted.includes(myId) && !rematch.declined.includes(myId);
+    const accepted = rematch.accepted.map(name).join("、") || "暂无";
+    el.innerHTML = `🔁 再来一局？座位将轮换（已同意：${accepted}，${rematch.declined.length} 人不再继续，约 ${left} 秒后截止）
+        ${canAnswer ? '<button class="btn-green" onclick="answerRematch(true)">再来一局</button> <button class="btn-red" onclick="answerRematch(false)">不玩了，观战</button>' : ''}`;
+    el.style.display = "block";
+}
+
+// renderSeries shows the totals of the games linked by rematches, fewest
+// bulls first. A single game is no series and hides the panel.
+export function renderSeries(series) {
+    const el = document.getElementById("series-panel");
+    if (!el) return;
+    if (!series || series.games < 2) {
+        el.style.display = "none";
+        el.innerHTML = "";
+        return;
+    }
+    const rows = Object.keys(series.totals)
+        .sort((a, b) => series.totals[a] - series.totals[b])
+        .map(id => `<tr><td>${series.names[id]}</td><td>${series.totals[id]} 🐮</td><td>${series.wins[id] || 0}</td></tr>`)
+        .join("");
+    el.innerHTML = `<div class="series-title">📈 系列赛（共 ${series.games} 局）</div>
+        <table><tr><th>玩家</th><th>累计</th><th>胜局</th></tr>${rows}</table>`;
+    el.style.display = "block";
+}
+
+// renderTracker shows the card tracker: for each row the unseen cards that
+// would land on it, then every card of the deck with the unseen ones lit.
+// A missing view hides the panel.
+export function renderTracker(unseen, hand) {
+    const el = document.getElementById("tracker-panel");
+    if (!el) return;
+    if (!unseen) {
+        el.style.display = "none";
+        el.innerHTML = "";
+        return;
+    }
+    const rows = unseen.rows.map(g => {
+        const range = g.next > 104 ? `${g.end + 1}-104` : `${g.end + 1}-${g.next - 1}`;
+        const mine = g.mine.length ? g.mine.join(", ") : "-";
+        return `<tr><td>第 ${g.row + 1} 行</td><td>${range}</td><td>${g.unseen}</td><td>${g.room}</td><td>${mine}</td></tr>`;
+    }).join("");
+    const unseenSet = new Set(unseen.cards);
+    const mineSet = new Set(hand.map(c => c.value));
+    let cells = "";
+    for (let v = 1; v <= 104; v++) {
+        const cls = mineSet.has(v) ? "mine" : (unseenSet.has(v) ? "unseen" : "");
+        cells += `<span class="${cls}">${v}</span>`;
+    }
+    el.innerHTML = `<div>🔢 记牌器：未见 ${unseen.cards.length} 张，其中 ${unseen.below} 张比所有行尾都小</div>` +
+        `<table><tr><th>行</th><th>落入区间</th><th>未见</th><th>空位</th><th>我的牌</th></tr>${rows}</table>` +
+        `<div class="tracker-grid">${cells}</div>`;
+    el.style.display = "block";
+}
+
 export function renderStats() {
     const tbody = document.getElementById("stats-body");
     tbody.innerHTML = "";
@@ -258,10 +416,12 @@ export function renderGameOver(players, myId) {
                 <span style="font-weight: bold;">${p.name}</span>
                 ${p.id === myId ? '<span style="color: #2980b9; margin-left: 5px;">(我)</span>' : ''}
                 ${i === 0 ? '<span style="color: #f1c40f; margin-left: 5px;">🏆 胜利</span>' : ''}
+                ${p.botAssisted ? '<span style="color: #7f8c8d; margin-left: 5px;" title="成绩不计入统计">🤖 代打</span>' : ''}
             </div>
             <div style="font-size: 20px; font-weight: bold; color: #e74c3c;">
                 ${p.score} 🐮
             </div>
+            <div class="game-over-pile">${renderPile(p.pile)}</div>
         `;
         container.appendChild(div);
     });
@@ -269,13 +429,247 @@ export function renderGameOver(players, myId) {
     modal.style.display = "flex";
 }
 
+// renderPile lists the cards a player collected, costliest first, so the
+// game-over modal shows which cards cost them.
+function renderPile(pile) {
+    if (!pile || pile.length === 0) return '<span class="pile-empty">没有收牌 🎉</span>';
+    return [...pile].sort((a, b) => b.score - a.score || a.value - b.value)
+        .map(c => `<span class="pile-card ${c.score >= 5 ? 'costly' : ''}">${c.value} · ${c.score}🐮</span>`)
+        .join("");
+}
+
 export function closeGameOver() {
     document.getElementById("game-over-modal").style.display = "none";
 }
 
-export function updateCountdownDisplay(count) {
-    const el = document.getElementById("countdown-display");
-    if (el) {
-        el.innerHTML = `⏱️ 新一局游戏将在 <strong>${count}</strong> 秒后开始...`;
+function createChatLine(m) {
+    const div = document.createElement("div");
+    div.className = `chat-line ${m.kind}`;
+    const name = document.createElement("span");
+    name.className = "chat-name";
+    name.textContent = m.name;
+    const text = document.createElement("span");
+    text.className = "chat-text";
+    text.textContent = m.text;
+    div.title = new Date(m.sentAt).toLocaleTimeString();
+    div.appendChild(name);
+    div.appendChild(text);
+    return div;
+}
+
+function fillChat(containerId, messages) {
+    const container = document.getElementById(containerId);
+    container.innerHTML = "";
+    (messages || []).forEach(m => container.appendChild(createChatLine(m)));
+    container.scrollTop = container.scrollHeight;
+}
+
+function pushChat(containerId, m) {
+    const container = document.getElementById(containerId);
+    container.appendChild(createChatLine(m));
+    container.scrollTop = container.scrollHeight;
+}
+
+export function renderChatHistory(messages) { fillChat("chat-messages", messages); }
+export function appendChat(m) { pushChat("chat-messages", m); }
+export function renderLobbyChatHistory(messages) { fillChat("lobby-chat-messages", messages); }
+export function appendLobbyChat(m) { pushChat("lobby-chat-messages", m); }
+
+export function lobbyNotice(text) {
+    pushChat("lobby-chat-messages", { name: "系统", kind: "notice", text: text, sentAt: Date.now() });
+    log(text); // Also visible while in a room
+}
+
+// renderAdjourned lists the adjourned games the user takes part in; the
+// section is hidden when there are none.
+export function renderAdjourned(list, onEnter) {
+    const section = document.getElementById("adjourned-section");
+    const container = document.getElementById("adjourned-list");
+    container.innerHTML = "";
+    section.style.display = list.length > 0 ? "block" : "none";
+    list.forEach(g => {
+        const div = document.createElement("div");
+        div.className = "tournament-item";
+        div.innerHTML = `
+            <div><strong>房间 ${g.roomId}</strong> <span class="tournament-meta">${new Date(g.adjournedAt).toLocaleString()} 休会 · ${g.names.join("、")}</span></div>
+            <button class="btn-small btn-green">回到对局</button>`;
+        div.querySelector("button").onclick = () => onEnter(g.roomId);
+        container.appendChild(div);
+    });
+}
+
+// renderYourMoves lists the correspondence games waiting on the user, the
+// most urgent first; the section is hidden when there are none.
+export function renderYourMoves(list, onEnter) {
+    const section = document.getElementById("your-move-section");
+    const container = document.getElementById("your-move-list");
+    container.innerHTML = "";
+    section.style.display = list.length > 0 ? "block" : "none";
+    list.forEach(g => {
+        const div = document.createElement("div");
+        div.className = "tournament-item";
+        div.innerHTML = `
+            <div><strong>房间 ${g.roomId}</strong> <span class="tournament-meta">${g.status === "choosing_row" ? "需要选行" : "需要出牌"} · ${new Date(g.deadline).toLocaleString()} 截止</span></div>
+            <button class="btn-small btn-green">去出牌</button>`;
+        div.querySelector("button").onclick = () => onEnter(g.roomId);
+        container.appendChild(div);
+    });
+}
+
+export function renderPresence(list) {
+    const container = document.getElementById("presence-list");
+    container.innerHTML = "";
+    if (list.length === 0) {
+        container.innerHTML = "<div style='color:#999;'>暂无在线玩家</div>";
+        return;
+    }
+    list.forEach(u => {
+        const div = document.createElement("div");
+        div.className = `presence-item ${u.id === getMyId() ? 'me' : ''}`;
+        div.textContent = u.roomId ? `${u.name} · 房间 ${u.roomId}` : `${u.name} · 大厅`;
+        container.appendChild(div);
+    });
+}
+
+// renderInviteList shows the online users who are not already in roomId.
+export function renderInviteList(list, roomId, onInvite) {
+    const container = document.getElementById("invite-list");
+    container.innerHTML = "";
+    const candidates = list.filter(u => u.id !== getMyId() && u.roomId !== roomId);
+    if (candidates.length === 0) {
+        container.innerHTML = "<div style='text-align:center; color:#999;'>大厅里暂时没有其他玩家</div>";
+        return;
+    }
+    candidates.forEach(u => {
+        const div = document.createElement("div");
+        div.className = "invite-item";
+        const label = document.createElement("span");
+        label.textContent = u.roomId ? `${u.name} (房间 ${u.roomId})` : u.name;
+        const btn = document.createElement("button");
+        btn.className = "btn-small btn-blue";
+        btn.innerText = "邀请";
+        btn.onclick = () => onInvite(u.id);
+        div.appendChild(label);
+        div.appendChild(btn);
+        container.appendChild(div);
+    });
+}
+
+export function setSpectatorMode(spectating) {
+    document.getElementById("game-controls").style.display = spectating ? "none" : "flex";
+    document.getElementById("hand").style.display = spectating ? "none" : "flex";
+    document.getElementById("hand-title").innerText = spectating ? "👀 观战中" : "你的手牌";
+    document.getElementById("chat-input-row").style.display = spectating ? "none" : "flex";
+    document.getElementById("emote-bar").style.display = spectating ? "none" : "flex";
+}
+
+// renderSeed shows the revealed seed of the last deal and, once the browser
+// has checked it, whether it matched the commitments.
+export function renderSeed(deal, problems) {
+    const el = document.getElementById("game-over-seed");
+    if (!el) return;
+    if (!deal) {
+        el.innerText = "";
+        return;
     }
-}
\ No newline at end of file
+    let verdict = "";
+    if (problems === null || problems === undefined) verdict = "（校验中…）";
+    else if (problems.length === 0) verdict = "✅ 发牌校验通过";
+    else verdict = "⚠️ 发牌校验失败：" + problems.join("；");
+    el.innerText = `本局种子：${deal.seed} ${verdict}`;
+}
+
+// renderDuplicate fills the duplicate scoreboard: overall standings, then
+// each finished board with the bulls of every seat at every table.
+export function renderDuplicate(board) {
+    document.getElementById("duplicate-summary").innerText =
+        `比赛 ${board.id}：${board.tables.length} 桌 × ${board.seats} 人，已完成 ${board.played}/${board.boards} 副`;
+    const myId = getMyId();
+    const tbody = document.getElementById("duplicate-standings");
+    tbody.innerHTML = "";
+    (board.standings || []).forEach((s, i) => {
+        const tr = document.createElement("tr");
+        if (s.playerId === myId) tr.style.fontWeight = "bold";
+        tr.innerHTML = `<td>${i + 1}</td><td>${s.name}</td><td>${s.table}</td><td>${s.matchPoints}</td><td>${s.penalty}</td>`;
+        tbody.appendChild(tr);
+    });
+    const container = document.getElementById("duplicate-boards");
+    container.innerHTML = "";
+    (board.results || []).forEach((res, b) => {
+        const table = document.createElement("table");
+        table.className = "duplicate-board";
+        let head = `<tr><th>第 ${b + 1} 副</th>`;
+        for (let k = 0; k < board.seats; k++) head += `<th>座位 ${k + 1}</th>`;
+        table.innerHTML = head + "</tr>";
+        board.tables.forEach(t => {
+            const r = res.tables[t];
+            if (!r) return;
+            const tr = document.createElement("tr");
+            let cells = `<td>${t}</td>`;
+            r.seating.forEach((pid, k) => {
+                cells += `<td>${board.names[pid] || pid}: ${r.scores[k]} 🐮</td>`;
+            });
+            tr.innerHTML = cells;
+            table.appendChild(tr);
+        });
+        container.appendChild(table);
+    });
+}
+
+const tournamentStatus = { registering: "报名中", running: "进行中", finished: "已结束" };
+
+// renderTournaments lists the tournaments in the lobby with the actions open
+// to the current user and an expandable standings table. onAction is called
+// with an action type ("tournament_join", "tournament_leave",
+// "tournament_start" or "enter") and the tournament or room ID.
+export function renderTournaments(list, myId, onAction) {
+    const container = document.getElementById("tournament-list");
+    container.innerHTML = "";
+    if (list.length === 0) {
+        container.innerHTML = "<div style='color:#999;'>暂无锦标赛</div>";
+        return;
+    }
+    list.forEach(t => {
+        const div = document.createElement("div");
+        div.className = "tournament-item";
+        const format = t.format === "knockout" ? "淘汰制" : `瑞士制 ${t.rounds} 轮`;
+        const round = t.status === "running" ? ` · 第 ${t.round} 轮` : "";
+        div.innerHTML = `
+            <div><strong>${t.name}</strong> <span class="tournament-meta">${t.id} · ${format} · 每桌 ${t.tableSize} 人 · 组织者 ${t.organizerName}</span></div>
+            <div class="tournament-meta">${tournamentStatus[t.status] || t.status}${round} · ${t.entrants.length} 名选手</div>
+            <div class="tournament-actions"></div>
+        `;
+        const actions = div.querySelector(".tournament-actions");
+        const addButton = (label, type, id) => {
+            const btn = document.createElement("button");
+            btn.className = "btn-small btn-blue";
+            btn.textContent = label;
+            btn.onclick = () => onAction(type, id);
+            actions.appendChild(btn);
+        };
+        const registered = t.entrants.some(e => e.id === myId);
+        if (t.status === "registering") {
+            addButton(registered ? "退出报名" : "报名", registered ? "tournament_leave" : "tournament_join", t.id);
+            if (t.organizerId === myId) addButton("开始比赛", "tournament_start", t.id);
+        }
+        const myTable = (t.tables || []).find(tb => !tb.done && tb.players.includes(myId));
+        if (myTable) addButton(`进入我的桌 ${myTable.roomId}`, "enter", myTable.roomId);
+
+        if (t.entrants.length > 0) {
+            const details = document.createElement("details");
+            details.innerHTML = "<summary>积分榜</summary>";
+            const table = document.createElement("table");
+            table.innerHTML = "<tr><th>名次</th><th>选手</th><th>局数</th><th>牛头</th><th>状态</th></tr>";
+            t.entrants.forEach((e, i) => {
+                const tr = document.createElement("tr");
+                if (e.id === myId) tr.style.fontWeight = "bold";
+                const state = e.eliminated ? `第 ${e.eliminated} 轮淘汰` : (t.status === "finished" && i === 0 ? "🏆 冠军" : "");
+                tr.innerHTML = `<td>${i + 1}</td><td>${e.name}</td><td>${e.games}</td><td>${e.penalty}</td><td>${state}</td>`;
+                table.appendChild(tr);
+            });
+            details.appendChild(table);
+            div.appendChild(details);
+        }
+        container.appendChild(div);
+    });
+}